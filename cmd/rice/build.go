@@ -1,19 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/davesmith10/rice-cli/internal/bundle"
+	"github.com/davesmith10/rice-cli/internal/sign"
 	"github.com/davesmith10/rice-cli/internal/validate"
 	"github.com/spf13/cobra"
 )
 
 func buildCmd() *cobra.Command {
 	var output string
-	var noValidate, force bool
+	var noValidate, force, reproducible bool
 
 	cmd := &cobra.Command{
 		Use:   "build [directory]",
@@ -21,18 +25,19 @@ func buildCmd() *cobra.Command {
 		Long:  `Create a ricecake bundle from a directory containing music and metadata.`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runBuild(args[0], output, noValidate, force)
+			return runBuild(args[0], output, noValidate, force, reproducible)
 		},
 	}
 
 	cmd.Flags().StringVar(&output, "output", "", "Output bundle path (default: [directory].ricecake)")
 	cmd.Flags().BoolVar(&noValidate, "no-validate", false, "Skip validation before building")
 	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing bundle")
+	cmd.Flags().BoolVar(&reproducible, "reproducible", true, "Write a byte-identical bundle for identical inputs")
 
 	return cmd
 }
 
-func runBuild(dir, output string, noValidate, force bool) error {
+func runBuild(dir, output string, noValidate, force, reproducible bool) error {
 	// Clean up directory path
 	dir = strings.TrimSuffix(dir, "/")
 	dir = strings.TrimSuffix(dir, "\\")
@@ -82,9 +87,14 @@ func runBuild(dir, output string, noValidate, force bool) error {
 		fmt.Println()
 	}
 
+	// Signatures made with rice sign on the directory go into the bundle
+	if err := checkSourceSignatures(dir); err != nil {
+		return err
+	}
+
 	// Build the bundle
 	fmt.Println("Building bundle...")
-	builder := bundle.NewBuilder(dir, output, verbose)
+	builder := bundle.NewBuilder(dir, output, reproducible, verbose)
 	if err := builder.Build(); err != nil {
 		return fmt.Errorf("build failed: %w", err)
 	}
@@ -101,3 +111,39 @@ func runBuild(dir, output string, noValidate, force bool) error {
 
 	return nil
 }
+
+// checkSourceSignatures makes sure signatures in the source directory
+// still cover its files, so the bundle is not built with signatures that
+// fail verification
+func checkSourceSignatures(dir string) error {
+	source := os.DirFS(dir)
+	files, err := sign.SignatureFiles(source)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	checksums, err := bundle.ComputeChecksums(source)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksums: %w", err)
+	}
+	index, err := checksums.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode checksums: %w", err)
+	}
+	contentHash := sha256.Sum256(index)
+
+	for _, name := range files {
+		data, err := fs.ReadFile(source, name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		sig, err := sign.ParseSignature(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if !bytes.Equal(sig.ContentHash, contentHash[:]) {
+			return fmt.Errorf("files changed since %s was made: sign the directory again or delete the signature", name)
+		}
+	}
+	return nil
+}
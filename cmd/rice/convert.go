@@ -1,50 +1,94 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
 
 	"github.com/davesmith10/rice-cli/internal/convert"
+	"github.com/davesmith10/rice-cli/internal/flac"
 	"github.com/spf13/cobra"
 )
 
 func convertCmd() *cobra.Command {
-	var outputDir string
+	var outputDir, format string
 	var bitrate int
 	var quality int
-	var force bool
+	var level int
+	var jobs int
+	var force, noTags bool
+	var manifestPath string
 
 	cmd := &cobra.Command{
 		Use:   "convert [files...]",
-		Short: "Convert WAV files to MP3",
-		Long: `Convert one or more WAV files to high-quality MP3 format.
+		Short: "Convert WAV files to MP3 or FLAC",
+		Long: `Convert one or more WAV files to high-quality MP3 or lossless FLAC format.
 
-Supports both constant bitrate (CBR) and variable bitrate (VBR) modes.
+MP3 supports both constant bitrate (CBR) and variable bitrate (VBR) modes.
 By default, uses CBR at 320 kbps for maximum quality.
 
+FLAC keeps the sample rate and bit depth of the WAV file (up to 24-bit).
+--compression-level trades speed for size as the reference encoder's -0 to
+-8 do; the audio is identical at every level.
+
+Files are converted in parallel, one per CPU unless --jobs says otherwise.
+Progress is reported in input order. Interrupting with Ctrl+C stops the
+running conversions and removes their incomplete output files.
+
+Files inside a bundle directory are tagged from its manifest.yaml: title,
+artist, album, track number, date, genre, composers, copyright and catalog
+number, with the cover image embedded. MP3 files get ID3v2.4 tags (see rice
+tag) and FLAC files Vorbis comments.
+
 Examples:
   rice convert track.wav                     # Single file
   rice convert *.wav                         # Multiple files (shell expansion)
   rice convert audio/                        # All WAV files in directory
   rice convert track.wav --bitrate 256       # Lower bitrate
   rice convert *.wav --output converted/     # Output to specific directory
-  rice convert *.wav --quality 2             # VBR mode (0-9, lower is better)`,
+  rice convert *.wav --quality 2             # VBR mode (0-9, lower is better)
+  rice convert audio/ --jobs 4               # At most 4 conversions at once
+  rice convert audio/ --format flac          # Lossless FLAC, default level 5`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runConvert(args, outputDir, bitrate, quality, force)
+			flags := cmd.Flags()
+			if format == convert.FormatFLAC && (flags.Changed("bitrate") || flags.Changed("quality")) {
+				return fmt.Errorf("--bitrate and --quality apply to MP3 only")
+			}
+			if format != convert.FormatFLAC && flags.Changed("compression-level") {
+				return fmt.Errorf("--compression-level applies to FLAC only")
+			}
+			return runConvert(args, outputDir, format, bitrate, quality, level, jobs, force, !noTags, manifestPath)
 		},
 	}
 
 	cmd.Flags().StringVarP(&outputDir, "output", "o", "", "Output directory (default: same as input)")
+	cmd.Flags().StringVarP(&format, "format", "F", convert.FormatMP3, "Output format: mp3 or flac")
 	cmd.Flags().IntVarP(&bitrate, "bitrate", "b", 320, "CBR bitrate: 128, 192, 256, 320 kbps")
 	cmd.Flags().IntVarP(&quality, "quality", "q", -1, "VBR quality: 0-9 (lower is better, overrides --bitrate)")
+	cmd.Flags().IntVar(&level, "compression-level", flac.DefaultLevel, "FLAC compression level: 0-8 (higher is smaller and slower)")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing output files")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Number of files to convert at once")
+	cmd.Flags().BoolVar(&noTags, "no-tags", false, "Do not write tags")
+	cmd.Flags().StringVar(&manifestPath, "manifest", "", "Bundle directory or manifest.yaml to take tags from (default: the input's bundle)")
 
 	return cmd
 }
 
-func runConvert(inputs []string, outputDir string, bitrate, quality int, force bool) error {
+func runConvert(inputs []string, outputDir, format string, bitrate, quality, level, jobs int, force, tags bool, manifestPath string) error {
 	// Validate flags
-	if quality >= 0 {
+	if err := convert.ValidateFormat(format); err != nil {
+		return err
+	}
+	if format == convert.FormatFLAC {
+		if err := convert.ValidateCompressionLevel(level); err != nil {
+			return err
+		}
+	} else if quality >= 0 {
 		if err := convert.ValidateQuality(quality); err != nil {
 			return err
 		}
@@ -54,11 +98,33 @@ func runConvert(inputs []string, outputDir string, bitrate, quality int, force b
 		}
 	}
 
+	if jobs < 1 {
+		return fmt.Errorf("invalid jobs %d: must be at least 1", jobs)
+	}
+
 	// Create converter
 	converter := convert.NewConverter(inputs, outputDir, bitrate, quality, force, verbose)
+	converter.Format = format
+	converter.CompressionLevel = level
+	converter.Jobs = jobs
+	converter.Tags = tags
+	if tags && manifestPath != "" {
+		album, err := loadAlbum(manifestPath)
+		if err != nil {
+			return err
+		}
+		converter.Album = album
+	}
+
+	// Ctrl+C cancels the conversions in progress
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Run conversion
-	results, err := converter.Convert()
+	results, err := converter.ConvertContext(ctx)
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("conversion interrupted")
+	}
 	if err != nil {
 		return err
 	}
@@ -1,12 +1,9 @@
 package main
 
 import (
-	"archive/zip"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 
+	"github.com/davesmith10/rice-cli/pkg/ricecake"
 	"github.com/spf13/cobra"
 )
 
@@ -32,26 +29,15 @@ directory or a .ricecake bundle file.`,
 }
 
 func runDescribe(path string, rawOutput bool) error {
-	info, err := os.Stat(path)
+	b, err := ricecake.Open(path)
 	if err != nil {
-		return fmt.Errorf("path not found: %s", path)
+		return err
 	}
+	defer b.Close()
 
-	var manifestData []byte
-
-	if info.IsDir() {
-		// Read manifest from directory
-		manifestPath := filepath.Join(path, "manifest.yaml")
-		manifestData, err = os.ReadFile(manifestPath)
-		if err != nil {
-			return fmt.Errorf("failed to read manifest: %w", err)
-		}
-	} else {
-		// Read manifest from .ricecake bundle (ZIP file)
-		manifestData, err = readManifestFromBundle(path)
-		if err != nil {
-			return fmt.Errorf("failed to read manifest from bundle: %w", err)
-		}
+	manifestData, err := b.ReadManifest()
+	if err != nil {
+		return err
 	}
 
 	if !rawOutput {
@@ -68,32 +54,3 @@ func runDescribe(path string, rawOutput bool) error {
 
 	return nil
 }
-
-// readManifestFromBundle reads the manifest.yaml from a .ricecake ZIP archive
-func readManifestFromBundle(bundlePath string) ([]byte, error) {
-	reader, err := zip.OpenReader(bundlePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open bundle: %w", err)
-	}
-	defer reader.Close()
-
-	// Look for manifest.yaml in the archive
-	for _, file := range reader.File {
-		if file.Name == "manifest.yaml" || file.Name == "./manifest.yaml" {
-			rc, err := file.Open()
-			if err != nil {
-				return nil, fmt.Errorf("failed to open manifest in bundle: %w", err)
-			}
-			defer rc.Close()
-
-			data, err := io.ReadAll(rc)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read manifest from bundle: %w", err)
-			}
-
-			return data, nil
-		}
-	}
-
-	return nil, fmt.Errorf("manifest.yaml not found in bundle")
-}
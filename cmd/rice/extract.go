@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+	"github.com/davesmith10/rice-cli/pkg/ricecake"
+	"github.com/spf13/cobra"
+)
+
+func extractCmd() *cobra.Command {
+	var paths []string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:     "extract [bundle] [directory]",
+		Aliases: []string{"unpack"},
+		Short:   "Extract a bundle into a source directory",
+		Long: `Extract a .ricecake bundle back into an editable source directory.
+
+The directory defaults to the bundle name without its extension. Use --path
+to extract only some files or directories, e.g. --path audio --path manifest.yaml.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := ""
+			if len(args) > 1 {
+				dir = args[1]
+			}
+			return runExtract(args[0], dir, paths, force)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&paths, "path", nil, "Extract only this file or directory (repeatable)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+
+	return cmd
+}
+
+func runExtract(bundlePath, dir string, paths []string, force bool) error {
+	b, err := ricecake.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if !b.IsArchive() {
+		return fmt.Errorf("not a bundle archive: %s", bundlePath)
+	}
+
+	// Determine output directory
+	if dir == "" {
+		dir = strings.TrimSuffix(bundlePath, filepath.Ext(bundlePath))
+	}
+
+	fmt.Printf("Extracting bundle: %s\n\n", filepath.Base(bundlePath))
+
+	extractor := bundle.NewExtractor(b.Archive())
+	extractor.Paths = paths
+	extractor.Overwrite = force
+	if verbose {
+		extractor.Progress = func(name string) {
+			fmt.Printf("  Extracting %s\n", name)
+		}
+	}
+
+	written, err := extractor.Extract(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("extraction failed: %w (use --force to overwrite)", err)
+		}
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+
+	if verbose {
+		fmt.Println()
+	}
+	fmt.Printf("Extracted %d file(s) to %s\n", len(written), dir)
+
+	return nil
+}
@@ -3,18 +3,18 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/davesmith10/rice-cli/internal/bundle"
+	"github.com/davesmith10/rice-cli/internal/sign"
 	"github.com/davesmith10/rice-cli/pkg/manifest"
+	"github.com/davesmith10/rice-cli/pkg/ricecake"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 )
 
 func infoCmd() *cobra.Command {
 	var jsonOutput, showTracks, verify bool
+	var pubkeyPath string
 
 	cmd := &cobra.Command{
 		Use:   "info [bundle]",
@@ -22,57 +22,35 @@ func infoCmd() *cobra.Command {
 		Long:  `Display detailed information about a ricecake bundle.`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runInfo(args[0], jsonOutput, showTracks, verify)
+			return runInfo(args[0], jsonOutput, showTracks, verify, pubkeyPath)
 		},
 	}
 
 	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
 	cmd.Flags().BoolVar(&showTracks, "tracks", false, "Show detailed track listing")
 	cmd.Flags().BoolVar(&verify, "verify", false, "Verify signature if present")
+	cmd.Flags().StringVar(&pubkeyPath, "pubkey", "", "Trust only this public key with --verify")
 
 	return cmd
 }
 
-func runInfo(path string, jsonOutput, showTracks, verify bool) error {
-	// Determine if it's a directory or bundle file
-	info, err := os.Stat(path)
+func runInfo(path string, jsonOutput, showTracks, verify bool, pubkeyPath string) error {
+	b, err := ricecake.Open(path)
 	if err != nil {
-		return fmt.Errorf("path not found: %s", path)
-	}
-
-	var manifestPath string
-	var bundleSize int64
-
-	if info.IsDir() {
-		manifestPath = filepath.Join(path, "manifest.yaml")
-		// Calculate directory size
-		filepath.Walk(path, func(_ string, info os.FileInfo, _ error) error {
-			if !info.IsDir() {
-				bundleSize += info.Size()
-			}
-			return nil
-		})
-	} else {
-		// It's a bundle file - for now just report we don't support it yet
-		return fmt.Errorf("reading .ricecake files not yet implemented - use the source directory")
+		return err
 	}
+	defer b.Close()
 
-	// Read manifest
-	data, err := os.ReadFile(manifestPath)
+	m, err := b.Manifest()
 	if err != nil {
-		return fmt.Errorf("failed to read manifest: %w", err)
-	}
-
-	var m manifest.Manifest
-	if err := yaml.Unmarshal(data, &m); err != nil {
-		return fmt.Errorf("failed to parse manifest: %w", err)
+		return err
 	}
 
 	if jsonOutput {
-		return outputInfoJSON(m, bundleSize, path)
+		return outputInfoJSON(*m, b.Size(), path)
 	}
 
-	return outputInfoText(m, bundleSize, path, showTracks, verify)
+	return outputInfoText(*m, b, showTracks, verify, pubkeyPath)
 }
 
 func outputInfoJSON(m manifest.Manifest, bundleSize int64, path string) error {
@@ -91,7 +69,7 @@ func outputInfoJSON(m manifest.Manifest, bundleSize int64, path string) error {
 	return nil
 }
 
-func outputInfoText(m manifest.Manifest, bundleSize int64, path string, showTracks, verify bool) error {
+func outputInfoText(m manifest.Manifest, b *ricecake.Bundle, showTracks, verify bool, pubkeyPath string) error {
 	fmt.Println("Bundle Information")
 	fmt.Println("==================")
 	fmt.Println()
@@ -128,15 +106,14 @@ func outputInfoText(m manifest.Manifest, bundleSize int64, path string, showTrac
 
 	fmt.Println()
 	fmt.Println("Bundle Details:")
-	fmt.Printf("  Size: %s\n", bundle.FormatSize(bundleSize))
+	fmt.Printf("  Size: %s\n", bundle.FormatSize(b.Size()))
 	fmt.Printf("  Created: %s\n", m.Bundle.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
 	fmt.Printf("  Tool: %s\n", m.Bundle.CreatedBy)
 
 	// Check for signature
-	sigPath := filepath.Join(path, "signature.sig")
-	if _, err := os.Stat(sigPath); err == nil {
+	if b.Signed() {
 		if verify {
-			fmt.Printf("  Signed: Yes (verification not yet implemented)\n")
+			fmt.Printf("  Signed: Yes (%s)\n", verifySummary(b, pubkeyPath))
 		} else {
 			fmt.Printf("  Signed: Yes\n")
 		}
@@ -163,6 +140,23 @@ func outputInfoText(m manifest.Manifest, bundleSize int64, path string, showTrac
 	return nil
 }
 
+// verifySummary verifies the bundle signature and describes the outcome
+func verifySummary(b *ricecake.Bundle, pubkeyPath string) string {
+	trust, err := trustedKeys(pubkeyPath)
+	if err != nil {
+		return fmt.Sprintf("cannot verify: %v", err)
+	}
+
+	results, err := b.SignaturesWith(trust)
+	if err == nil {
+		_, err = sign.Outcome(results, trust.Keys...)
+	}
+	if err != nil {
+		return fmt.Sprintf("INVALID: %v", err)
+	}
+	return "verified"
+}
+
 func calculateTotalDuration(tracks []manifest.Track) string {
 	totalSeconds := 0
 
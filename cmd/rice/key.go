@@ -0,0 +1,559 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davesmith10/rice-cli/internal/keyring"
+	"github.com/davesmith10/rice-cli/internal/sign"
+	"github.com/spf13/cobra"
+)
+
+func keyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "key",
+		Short: "Manage the keyring",
+		Long: `Manage named signing keys and trusted public keys.
+
+The keyring lives in ~/.rice/keyring (override with RICE_KEYRING). Keys are
+referred to by name, by key ID or by fingerprint. Verification trusts every
+key in the keyring that has not been revoked.`,
+	}
+
+	cmd.AddCommand(keyListCmd())
+	cmd.AddCommand(keyImportCmd())
+	cmd.AddCommand(keyExportCmd())
+	cmd.AddCommand(keyFingerprintCmd())
+	cmd.AddCommand(keyRevokeCmd())
+	cmd.AddCommand(keyPasswdCmd())
+	cmd.AddCommand(keyValidityCmd())
+
+	return cmd
+}
+
+func keyListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List keys in the keyring",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyList()
+		},
+	}
+}
+
+func runKeyList() error {
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+
+	keys := kr.Keys()
+	if len(keys) == 0 {
+		fmt.Println("The keyring is empty. Create a key with: rice keygen --name NAME")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-16s %-9s %-9s %s\n", "NAME", "ID", "TYPE", "STATUS", "FINGERPRINT")
+	for _, key := range keys {
+		kind := "public"
+		if key.Secret {
+			kind = "secret"
+		}
+		if kr.Encrypted(key) {
+			kind = "encrypted"
+		}
+		status := "trusted"
+		switch {
+		case key.Revoked() && !time.Now().Before(*key.RevokedAt):
+			status = "revoked"
+		case key.NotAfter != nil && time.Now().After(*key.NotAfter):
+			status = "expired"
+		case key.Usage == keyring.UsageTimestamp:
+			status = "timestamp"
+		}
+		fmt.Printf("%-20s %-16s %-9s %-9s %s\n", key.Name, key.ID, kind, status, key.Fingerprint)
+	}
+
+	return nil
+}
+
+func keyImportCmd() *cobra.Command {
+	var name string
+	var timestamping bool
+
+	cmd := &cobra.Command{
+		Use:   "import [key-file]",
+		Short: "Import a private or public key",
+		Long: `Import a key file into the keyring. Public keys become trusted for
+verification; private keys can also be used with rice sign --key NAME.
+
+With --timestamping the key is trusted as a timestamp authority instead: its
+timestamp tokens date signatures, but it is never trusted as a signer. Only
+the public half is imported.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyImport(args[0], name, timestamping)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Key name (default: file name without extension)")
+	cmd.Flags().BoolVar(&timestamping, "timestamping", false, "Trust the key as a timestamp authority")
+
+	return cmd
+}
+
+func runKeyImport(path, name string, timestamping bool) error {
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var key *keyring.Key
+	if timestamping {
+		publicKey, err := loadPublicKeyRef(path)
+		if err != nil {
+			return err
+		}
+		if key, err = kr.AddPublic(name, publicKey, keyring.UsageTimestamp); err != nil {
+			return err
+		}
+	} else if _, err := sign.KeyFilePublicKey(data, nil); err == nil || errors.Is(err, sign.ErrPassphraseRequired) {
+		key, err = kr.AddPrivate(name, data, keyPassphrase(path))
+		if err != nil {
+			return err
+		}
+	} else {
+		publicKey, perr := sign.LoadPublicKey(path)
+		if perr != nil {
+			return fmt.Errorf("not a private or public key: %s", path)
+		}
+		key, err = kr.AddPublic(name, publicKey, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Imported key %s\n", key.Name)
+	fmt.Printf("  ID:          %s\n", key.ID)
+	fmt.Printf("  Fingerprint: %s\n", key.Fingerprint)
+
+	return nil
+}
+
+func keyExportCmd() *cobra.Command {
+	var output, format string
+	var private bool
+
+	cmd := &cobra.Command{
+		Use:   "export [key]",
+		Short: "Export a public key (or private key with --private)",
+		Long: `Export a public key in the given format, or the private key file as
+stored in the keyring with --private.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyExport(args[0], output, format, private)
+		},
+	}
+
+	cmd.Flags().StringVar(&output, "output", "", "Write to file instead of stdout")
+	cmd.Flags().StringVar(&format, "format", sign.FormatRaw, "Public key format: raw, pkcs8 or openssh")
+	cmd.Flags().BoolVar(&private, "private", false, "Export the private key")
+
+	return cmd
+}
+
+func runKeyExport(ref, output, format string, private bool) error {
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+	key, err := kr.Find(ref)
+	if err != nil {
+		return err
+	}
+
+	data, err := sign.MarshalPublicKey(key.PublicKey(), format)
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if private {
+		path, err := kr.PrivateKeyPath(key)
+		if err != nil {
+			return err
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+		perm = 0600
+	}
+
+	if output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, perm); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return nil
+}
+
+func keyFingerprintCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "fingerprint [key-or-file]",
+		Short: "Show the ID and fingerprint of a key",
+		Long:  `Show the key ID and fingerprint of a keyring key or of a key file.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyFingerprint(args[0])
+		},
+	}
+}
+
+func runKeyFingerprint(ref string) error {
+	publicKey, err := loadPublicKeyRef(ref)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ID:          %s\n", sign.KeyID(publicKey))
+	fmt.Printf("Fingerprint: %s\n", sign.Fingerprint(publicKey))
+	return nil
+}
+
+func keyRevokeCmd() *cobra.Command {
+	var reason, effective string
+
+	cmd := &cobra.Command{
+		Use:   "revoke [key]",
+		Short: "Revoke a key so it is no longer trusted",
+		Long: `Revoke a key from the --effective date on (default: now). Signatures
+the key made before that date stay valid; to reject everything signed
+since a key was compromised, backdate the revocation to the compromise.
+
+A signature's date comes from its timestamp token if a trusted timestamp
+authority issued one, otherwise from the signer's clock.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyRevoke(args[0], reason, effective)
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "", "Reason for the revocation")
+	cmd.Flags().StringVar(&effective, "effective", "", "Date the revocation takes effect (YYYY-MM-DD or RFC 3339)")
+
+	return cmd
+}
+
+func runKeyRevoke(ref, reason, effective string) error {
+	at := time.Now()
+	if effective != "" {
+		var err error
+		if at, err = parseDate(effective); err != nil {
+			return err
+		}
+	}
+
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+	key, err := kr.Revoke(ref, reason, at)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked key %s (%s)\n", key.Name, key.Fingerprint)
+	fmt.Printf("  Effective: %s\n", key.RevokedAt.Format(time.RFC3339))
+	return nil
+}
+
+func keyValidityCmd() *cobra.Command {
+	var from, until string
+
+	cmd := &cobra.Command{
+		Use:   "validity [key]",
+		Short: "Set the period in which a key may sign",
+		Long: `Set the period in which a key may sign. Signing with the key outside
+the period fails, the period is recorded in its signatures, and verification
+rejects signatures made outside it. Signatures made within the period stay
+valid after it ends. Use "none" to remove a bound.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyValidity(args[0], from, until)
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Start of the period (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().StringVar(&until, "until", "", "End of the period (YYYY-MM-DD or RFC 3339)")
+
+	return cmd
+}
+
+func runKeyValidity(ref, from, until string) error {
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+	key, err := kr.Find(ref)
+	if err != nil {
+		return err
+	}
+
+	notBefore, notAfter := key.NotBefore, key.NotAfter
+	if notBefore, err = parseBound(from, notBefore); err != nil {
+		return err
+	}
+	if notAfter, err = parseBound(until, notAfter); err != nil {
+		return err
+	}
+	if key, err = kr.SetValidity(ref, notBefore, notAfter); err != nil {
+		return err
+	}
+
+	fmt.Printf("Key %s is valid %s\n", key.Name, validityText(key))
+	return nil
+}
+
+// parseBound parses a --from or --until value: empty keeps current, and
+// "none" removes the bound
+func parseBound(value string, current *time.Time) (*time.Time, error) {
+	switch value {
+	case "":
+		return current, nil
+	case "none":
+		return nil, nil
+	}
+	t, err := parseDate(value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseDate parses an RFC 3339 time or a YYYY-MM-DD date (midnight UTC)
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or RFC 3339)", value)
+	}
+	return t, nil
+}
+
+// validityText describes a key's validity period, e.g. "from 2026-01-01
+// until 2027-01-01"
+func validityText(key *keyring.Key) string {
+	var parts []string
+	if key.NotBefore != nil {
+		parts = append(parts, "from "+key.NotBefore.Format("2006-01-02"))
+	}
+	if key.NotAfter != nil {
+		parts = append(parts, "until "+key.NotAfter.Format("2006-01-02"))
+	}
+	if len(parts) == 0 {
+		return "indefinitely"
+	}
+	return strings.Join(parts, " ")
+}
+
+func keyPasswdCmd() *cobra.Command {
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:   "passwd [key-or-file]",
+		Short: "Set, change or remove the passphrase of a private key",
+		Long: `Set, change or remove the passphrase protecting a keyring key or a
+private key file.
+
+The current passphrase is read from RICE_KEY_PASSPHRASE and the new one from
+RICE_NEW_KEY_PASSPHRASE; either is prompted for when not set.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyPasswd(args[0], remove)
+		},
+	}
+
+	cmd.Flags().BoolVar(&remove, "remove", false, "Remove the passphrase and store the key unencrypted")
+
+	return cmd
+}
+
+func runKeyPasswd(ref string, remove bool) error {
+	var kr *keyring.Keyring
+	var key *keyring.Key
+	path := ref
+	if _, err := os.Stat(ref); err != nil {
+		if kr, err = keyring.Open(keyring.DefaultDir()); err != nil {
+			return err
+		}
+		if key, err = kr.Find(ref); err != nil {
+			return err
+		}
+		if path, err = kr.PrivateKeyPath(key); err != nil {
+			return err
+		}
+		ref = key.Name
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	privateKey, err := sign.ParsePrivateKey(data, keyPassphrase(ref))
+	if err != nil {
+		return fmt.Errorf("failed to load private key: %w", err)
+	}
+
+	// Keep the format, so OpenSSH keys stay usable with ssh-keygen
+	var passphrase []byte
+	if remove {
+		if !sign.IsEncryptedKey(data) {
+			return fmt.Errorf("%s is not encrypted", ref)
+		}
+	} else if passphrase, err = newPassphrase(newPassphraseEnv); err != nil {
+		return err
+	}
+	if data, err = sign.MarshalPrivateKey(privateKey, sign.KeyFileFormat(data), passphrase); err != nil {
+		return err
+	}
+
+	if kr != nil {
+		err = kr.SetPrivate(key, data, func() ([]byte, error) { return passphrase, nil })
+	} else {
+		err = replaceFile(path, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	if remove {
+		fmt.Printf("Removed the passphrase from %s\n", ref)
+	} else {
+		fmt.Printf("Updated the passphrase of %s\n", ref)
+	}
+	return nil
+}
+
+// replaceFile writes data to a temporary file next to path and renames it
+// over path, so an interrupted write never loses the key
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return nil
+}
+
+// loadSigningKey loads a private key from a file or, if no such file
+// exists, from the keyring key with that name, ID or fingerprint
+func loadSigningKey(ref string) (ed25519.PrivateKey, error) {
+	if _, err := os.Stat(ref); err == nil {
+		return sign.LoadPrivateKey(ref, keyPassphrase(ref))
+	}
+
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return nil, err
+	}
+	key, err := kr.Find(ref)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no key file or keyring key named %s", ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	path, err := kr.PrivateKeyPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return sign.LoadPrivateKey(path, keyPassphrase(key.Name))
+}
+
+// loadPublicKeyRef loads a public key from a public or private key file or,
+// if no such file exists, from the keyring. Private keys are only
+// decrypted if their public half cannot be read otherwise.
+func loadPublicKeyRef(ref string) (ed25519.PublicKey, error) {
+	if data, err := os.ReadFile(ref); err == nil {
+		publicKey, err := sign.KeyFilePublicKey(data, keyPassphrase(ref))
+		if err == nil {
+			return publicKey, nil
+		}
+		if sign.IsEncryptedKey(data) {
+			return nil, fmt.Errorf("failed to load public key: %w", err)
+		}
+		publicKey, err = sign.ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key: %w", err)
+		}
+		return publicKey, nil
+	}
+
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return nil, err
+	}
+	key, err := kr.Find(ref)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no key file or keyring key named %s", ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key.PublicKey(), nil
+}
+
+// trustedKeys returns what verification trusts: the keyring's keys and
+// ~/.rice/public.key, or only the key in pubkeyPath if given. Key validity
+// periods, revocations and timestamp authorities always come from the
+// keyring.
+func trustedKeys(pubkeyPath string) (*sign.Trust, error) {
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return nil, err
+	}
+	trust := kr.Trust()
+
+	if pubkeyPath != "" {
+		publicKey, err := sign.LoadPublicKey(pubkeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key: %w", err)
+		}
+		trust.Keys = []ed25519.PublicKey{publicKey}
+		return trust, nil
+	}
+
+	// Keys written by earlier versions of rice keygen are still trusted;
+	// if the keyring knows the key, its policy applies
+	if publicKey, err := sign.LoadPublicKey(defaultPublicKeyPath()); err == nil {
+		if kr.Lookup(sign.Fingerprint(publicKey)) == nil {
+			trust.Keys = append(trust.Keys, publicKey)
+		}
+	}
+
+	if len(trust.Keys) == 0 {
+		return nil, fmt.Errorf("no trusted keys: import one with rice key import, or pass --pubkey")
+	}
+	return trust, nil
+}
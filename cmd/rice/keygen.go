@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/davesmith10/rice-cli/internal/keyring"
 	"github.com/davesmith10/rice-cli/internal/sign"
 	"github.com/spf13/cobra"
 )
@@ -14,14 +15,39 @@ func init() {
 }
 
 func keygenCmd() *cobra.Command {
-	var outputDir string
+	var outputDir, name, format string
+	var encrypt bool
 
 	cmd := &cobra.Command{
 		Use:   "keygen",
 		Short: "Generate Ed25519 key pair for signing",
-		Long:  `Generate a new Ed25519 key pair for signing ricecake bundles.`,
+		Long: `Generate a new Ed25519 key pair for signing ricecake bundles.
+
+With --name the key is added to the keyring, which can hold any number of
+keys. Otherwise private.key and public.key are written to --output.
+
+With --encrypt the private key is protected by a passphrase, read from
+RICE_KEY_PASSPHRASE or prompted for. Signing with the key asks for it again.
+The key is encrypted as its format defines, so pkcs8 keys are standard
+encrypted PKCS#8 that openssl can read.
+
+--format selects the key file format: raw (the rice format), pkcs8 (PKCS#8 and
+PKIX PEM, as written by openssl) or openssh (as written by ssh-keygen).`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runKeygen(outputDir)
+			if err := sign.ValidateFormat(format); err != nil {
+				return err
+			}
+			var passphrase []byte
+			if encrypt {
+				var err error
+				if passphrase, err = newPassphrase(passphraseEnv); err != nil {
+					return err
+				}
+			}
+			if name != "" {
+				return runKeygenNamed(name, format, passphrase)
+			}
+			return runKeygen(outputDir, format, passphrase)
 		},
 	}
 
@@ -29,11 +55,14 @@ func keygenCmd() *cobra.Command {
 	defaultDir := filepath.Join(homeDir, ".rice")
 
 	cmd.Flags().StringVar(&outputDir, "output", defaultDir, "Output directory for keys")
+	cmd.Flags().StringVar(&name, "name", "", "Add the key to the keyring under this name")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Protect the private key with a passphrase")
+	cmd.Flags().StringVar(&format, "format", sign.FormatRaw, "Key file format: raw, pkcs8 or openssh")
 
 	return cmd
 }
 
-func runKeygen(outputDir string) error {
+func runKeygen(outputDir, format string, passphrase []byte) error {
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0700); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
@@ -58,7 +87,7 @@ func runKeygen(outputDir string) error {
 	}
 
 	// Save keys
-	if err := sign.SaveKeyPair(publicKey, privateKey, outputDir); err != nil {
+	if err := sign.SaveKeyPair(publicKey, privateKey, outputDir, format, passphrase); err != nil {
 		return fmt.Errorf("failed to save keys: %w", err)
 	}
 
@@ -72,3 +101,28 @@ func runKeygen(outputDir string) error {
 
 	return nil
 }
+
+func runKeygenNamed(name, format string, passphrase []byte) error {
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Generating Ed25519 key pair...")
+	key, err := kr.Generate(name, format, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Printf("Key %s added to the keyring.\n", key.Name)
+	fmt.Printf("  ID:          %s\n", key.ID)
+	fmt.Printf("  Fingerprint: %s\n", key.Fingerprint)
+	fmt.Println()
+	fmt.Println("To sign bundles, use:")
+	fmt.Printf("  rice sign mybundle.ricecake --key %s\n", key.Name)
+	fmt.Println("To share the public key, use:")
+	fmt.Printf("  rice key export %s --output %s.pub\n", key.Name, key.Name)
+
+	return nil
+}
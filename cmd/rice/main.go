@@ -30,11 +30,16 @@ as a single archive file.`,
 	rootCmd.AddCommand(buildCmd())
 	rootCmd.AddCommand(validateCmd())
 	rootCmd.AddCommand(signCmd())
+	rootCmd.AddCommand(verifyCmd())
 	rootCmd.AddCommand(testCmd())
 	rootCmd.AddCommand(infoCmd())
 	rootCmd.AddCommand(describeCmd())
+	rootCmd.AddCommand(manifestCmd())
 	rootCmd.AddCommand(keygenCmd())
+	rootCmd.AddCommand(keyCmd())
+	rootCmd.AddCommand(extractCmd())
 	rootCmd.AddCommand(convertCmd())
+	rootCmd.AddCommand(tagCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
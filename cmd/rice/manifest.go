@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davesmith10/rice-cli/internal/manifestsync"
+	"github.com/spf13/cobra"
+)
+
+func manifestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Manage manifest.yaml",
+		Long:  `Commands for maintaining the manifest.yaml of a bundle directory.`,
+	}
+
+	cmd.AddCommand(manifestSyncCmd())
+
+	return cmd
+}
+
+func manifestSyncCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync [directory]",
+		Short: "Fill in durations, dimensions and formats from the files",
+		Long: `Inspect the files in a bundle directory and update manifest.yaml with
+the real track durations, image dimensions and the audio formats present.
+
+Comments and key order in manifest.yaml are preserved.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runManifestSync(args[0], dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes as a diff without writing them")
+
+	return cmd
+}
+
+func runManifestSync(dir string, dryRun bool) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("source directory not found: %s", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	result, err := manifestsync.Sync(dir)
+	if err != nil {
+		return err
+	}
+
+	if !result.Changed() {
+		fmt.Println("manifest.yaml is already in sync.")
+		return nil
+	}
+
+	manifestPath := filepath.Join(dir, "manifest.yaml")
+
+	if dryRun {
+		fmt.Print(manifestsync.Diff(manifestPath, string(result.Original), string(result.Updated)))
+		fmt.Println()
+		fmt.Printf("%d change(s), not written (dry run).\n", len(result.Changes))
+		return nil
+	}
+
+	for _, change := range result.Changes {
+		fmt.Printf("  %s\n", change)
+	}
+
+	stat, err := os.Stat(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, result.Updated, stat.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Printf("Updated manifest.yaml (%d change(s)).\n", len(result.Changes))
+
+	return nil
+}
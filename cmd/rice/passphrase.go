@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/davesmith10/rice-cli/internal/sign"
+	"golang.org/x/term"
+)
+
+const (
+	// passphraseEnv supplies the passphrase of encrypted keys without a prompt
+	passphraseEnv = "RICE_KEY_PASSPHRASE"
+
+	// newPassphraseEnv supplies the new passphrase for rice key passwd
+	newPassphraseEnv = "RICE_NEW_KEY_PASSPHRASE"
+)
+
+// keyPassphrase returns a PassphraseFunc that reads RICE_KEY_PASSPHRASE,
+// or prompts for the passphrase of the named key
+func keyPassphrase(name string) sign.PassphraseFunc {
+	return func() ([]byte, error) {
+		if passphrase, ok := os.LookupEnv(passphraseEnv); ok {
+			return []byte(passphrase), nil
+		}
+		return readPassphrase(fmt.Sprintf("Enter passphrase for %s: ", name))
+	}
+}
+
+// newPassphrase returns the passphrase for a key being encrypted, from
+// envVar if set, otherwise by prompting twice
+func newPassphrase(envVar string) ([]byte, error) {
+	if passphrase, ok := os.LookupEnv(envVar); ok {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s is empty", envVar)
+		}
+		return []byte(passphrase), nil
+	}
+
+	passphrase, err := readPassphrase("Enter new passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+	confirm, err := readPassphrase("Confirm new passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// readPassphrase prompts on stderr and reads a line from the terminal
+// without echoing it
+func readPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w: set %s or run in a terminal", sign.ErrPassphraseRequired, passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
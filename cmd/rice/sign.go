@@ -1,69 +1,214 @@
 package main
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/davesmith10/rice-cli/internal/keyring"
 	"github.com/davesmith10/rice-cli/internal/sign"
 	"github.com/spf13/cobra"
 )
 
 func signCmd() *cobra.Command {
-	var keyPath, keyEnv string
+	var keyPath, keyEnv, role, signerCommand, tsaKey string
+	var appendSig, useAgent, detached bool
 
 	cmd := &cobra.Command{
-		Use:   "sign [bundle]",
+		Use:   "sign [bundle|directory]",
 		Short: "Add digital signature to a bundle",
-		Long:  `Add a digital signature to a ricecake bundle using Ed25519.`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Add a digital signature to a ricecake bundle using Ed25519.
+
+Each signature is stored as signatures/<key-id>.sig and records the signer's
+key fingerprint and role. By default signing replaces existing signatures;
+use --append to co-sign a bundle that others have already signed.
+
+Signing a source directory writes checksums.yaml and the signature into it,
+so rice build bakes the signature into the bundle. Any change to the files
+after signing invalidates it. With --detached the archive is left untouched
+and the signature is written to <bundle>.sig next to it; rice verify checks
+it along with any embedded signatures.
+
+The private key need not be on disk. With --agent the key is held by the
+ssh-agent at SSH_AUTH_SOCK; with --signer-command an external program signs.
+The command is split into arguments with shell quoting rules but is not run
+by a shell. It reads the signature header block, which includes the SHA-256
+hash of checksums.yaml, on stdin, and prints the Ed25519 signature of those
+bytes, raw or base64, on stdout. In both cases --key names the public key
+(a file or keyring key) to sign with.
+
+If the keyring gives the key a validity period, signing outside it fails and
+the period is recorded in the signature; a revoked key cannot sign. With
+--tsa-key the signature is timestamped by that key acting as a local
+timestamp authority, so verifiers that trust it can date the signature
+without relying on the signer's clock.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSign(args[0], keyPath, keyEnv)
+			key, err := signingKey(keyPath, keyEnv, useAgent, signerCommand)
+			if err != nil {
+				return err
+			}
+			if closer, ok := key.(io.Closer); ok {
+				defer closer.Close()
+			}
+			var tsa sign.Timestamper
+			if tsaKey != "" {
+				if tsa, err = timestampAuthority(tsaKey); err != nil {
+					return err
+				}
+			}
+			return runSign(args[0], key, role, appendSig, detached, tsa)
 		},
 	}
 
-	cmd.Flags().StringVar(&keyPath, "key", "", "Path to private key file")
+	cmd.Flags().StringVar(&keyPath, "key", "", "Private key file, or name of a keyring key")
 	cmd.Flags().StringVar(&keyEnv, "key-env", "RICE_SIGNING_KEY", "Environment variable containing key")
+	cmd.Flags().StringVar(&role, "role", sign.RoleArtist, "Signer role: artist, label or distributor")
+	cmd.Flags().BoolVar(&appendSig, "append", false, "Keep existing signatures by other keys")
+	cmd.Flags().BoolVar(&detached, "detached", false, "Write the signature to <bundle>.sig instead of into the bundle")
+	cmd.Flags().BoolVar(&useAgent, "agent", false, "Sign with a key held by ssh-agent")
+	cmd.Flags().StringVar(&signerCommand, "signer-command", "", "Sign by running this command: it reads the signature header block on stdin and prints its Ed25519 signature")
+	cmd.Flags().StringVar(&tsaKey, "tsa-key", "", "Timestamp the signature with this private key file or keyring key")
+	cmd.MarkFlagsMutuallyExclusive("agent", "signer-command")
 
 	return cmd
 }
 
-func runSign(bundlePath, keyPath, keyEnv string) error {
-	// Check bundle exists
-	if _, err := os.Stat(bundlePath); os.IsNotExist(err) {
-		return fmt.Errorf("bundle not found: %s", bundlePath)
-	}
+// signingKey returns the key to sign with: a private key file or keyring
+// key, the key in keyEnv, an ssh-agent key, or an external command
+func signingKey(keyPath, keyEnv string, useAgent bool, signerCommand string) (crypto.Signer, error) {
+	switch {
+	case useAgent:
+		var publicKey ed25519.PublicKey
+		if keyPath != "" {
+			var err error
+			if publicKey, err = loadPublicKeyRef(keyPath); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Println("Using key from ssh-agent")
+		return sign.NewAgentSigner(publicKey)
 
-	// Load private key
-	var privateKey ed25519.PrivateKey
-	var err error
+	case signerCommand != "":
+		if keyPath == "" {
+			return nil, fmt.Errorf("--signer-command requires --key with the public key to sign for")
+		}
+		publicKey, err := loadPublicKeyRef(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Using signer command: %s\n", signerCommand)
+		return sign.NewCommandSigner(signerCommand, publicKey)
 
-	if keyPath != "" {
+	case keyPath != "":
 		fmt.Printf("Loading key from: %s\n", keyPath)
-		privateKey, err = sign.LoadPrivateKey(keyPath)
+		privateKey, err := loadSigningKey(keyPath)
 		if err != nil {
-			return fmt.Errorf("failed to load private key: %w", err)
+			return nil, fmt.Errorf("failed to load private key: %w", err)
 		}
-	} else {
+		return privateKey, nil
+
+	default:
 		fmt.Printf("Loading key from environment: %s\n", keyEnv)
-		privateKey, err = sign.LoadPrivateKeyFromEnv(keyEnv)
+		privateKey, err := sign.LoadPrivateKeyFromEnv(keyEnv)
 		if err != nil {
-			return fmt.Errorf("failed to load private key from environment: %w", err)
+			return nil, fmt.Errorf("failed to load private key from environment: %w", err)
 		}
+		return privateKey, nil
+	}
+}
+
+// timestampAuthority loads the key of a local timestamp authority
+func timestampAuthority(ref string) (sign.Timestamper, error) {
+	key, err := loadSigningKey(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timestamp authority key: %w", err)
+	}
+	return sign.NewLocalAuthority(key)
+}
+
+func runSign(bundlePath string, key crypto.Signer, role string, appendSig, detached bool, tsa sign.Timestamper) error {
+	// Check bundle exists
+	info, err := os.Stat(bundlePath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("bundle not found: %s", bundlePath)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot stat bundle: %w", err)
+	}
+	if detached && info.IsDir() {
+		return fmt.Errorf("--detached signs a built bundle, not a directory")
+	}
+
+	if err := sign.ValidateRole(role); err != nil {
+		return err
 	}
 
 	fmt.Printf("Signing bundle: %s\n\n", filepath.Base(bundlePath))
 
 	// Create signer and sign bundle
-	signer := sign.NewSigner(privateKey, verbose)
-	if err := signer.SignBundle(bundlePath); err != nil {
+	signer := sign.NewSigner(key, verbose)
+	signer.Role = role
+	signer.Append = appendSig
+	signer.Timestamper = tsa
+	if err := applyKeyPolicy(signer, key); err != nil {
+		return err
+	}
+
+	sigPath := signer.SignatureName()
+	switch {
+	case info.IsDir():
+		err = signer.SignDirectory(bundlePath)
+		sigPath = filepath.Join(bundlePath, filepath.FromSlash(sigPath))
+	case detached:
+		sigPath, err = signer.SignDetached(bundlePath)
+	default:
+		err = signer.SignBundle(bundlePath)
+	}
+	if err != nil {
 		return fmt.Errorf("signing failed: %w", err)
 	}
 
 	fmt.Println()
 	fmt.Println("Bundle signed successfully.")
-	fmt.Println("  Signature: signature.sig")
+	fmt.Printf("  Signature:   %s\n", sigPath)
+	fmt.Printf("  Fingerprint: %s\n", sign.Fingerprint(key.Public().(ed25519.PublicKey)))
+	fmt.Printf("  Role:        %s\n", role)
+	if tsa != nil {
+		fmt.Printf("  Timestamped: yes\n")
+	}
 
 	return nil
 }
+
+// applyKeyPolicy refuses to sign with a key the keyring has revoked and
+// records the key's validity period in the signature
+func applyKeyPolicy(signer *sign.Signer, key crypto.Signer) error {
+	publicKey, ok := key.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil
+	}
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+	entry := kr.Lookup(sign.Fingerprint(publicKey))
+	if entry == nil {
+		return nil
+	}
+
+	if entry.RevokedAt != nil && !time.Now().Before(*entry.RevokedAt) {
+		return fmt.Errorf("key %s was revoked on %s", entry.Name, entry.RevokedAt.Format(time.RFC3339))
+	}
+	if entry.NotBefore != nil {
+		signer.ValidFrom = *entry.NotBefore
+	}
+	if entry.NotAfter != nil {
+		signer.ValidUntil = *entry.NotAfter
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/id3"
+	"github.com/spf13/cobra"
+)
+
+func tagCmd() *cobra.Command {
+	var manifestPath string
+
+	cmd := &cobra.Command{
+		Use:   "tag [files...]",
+		Short: "Write ID3 tags to MP3 files from the manifest",
+		Long: `Write ID3v2.4 tags and cover art to MP3 files from a bundle's manifest.yaml.
+
+Each file is matched to the track whose filename is the file name without
+.mp3, and gets its title, track number, composers, the release's artist,
+album, date, genre and catalog number, the copyright, and the cover image
+as front cover art. Existing ID3v2 tags are replaced.
+
+Directories are expanded to the MP3 files in them, and a bundle directory to
+the MP3 files in its audio/ directory. Unless --manifest is given, each
+file's manifest.yaml is looked for next to it, then one directory up.
+
+Examples:
+  rice tag my-album                               # Every MP3 in my-album/audio
+  rice tag track.mp3 --manifest my-album          # Tag from another bundle`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTag(args, manifestPath)
+		},
+	}
+
+	cmd.Flags().StringVar(&manifestPath, "manifest", "", "Bundle directory or manifest.yaml to take tags from")
+
+	return cmd
+}
+
+func runTag(inputs []string, manifestPath string) error {
+	var album *id3.Album
+	if manifestPath != "" {
+		var err error
+		if album, err = loadAlbum(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	files, err := expandMP3Inputs(inputs)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no MP3 files found")
+	}
+
+	loaded := make(map[string]*id3.Album)
+	failed := 0
+	for i, file := range files {
+		fmt.Printf("[%d/%d] %s... ", i+1, len(files), filepath.Base(file))
+
+		fileAlbum := album
+		if fileAlbum == nil {
+			dir := id3.FindAlbumDir(file)
+			if dir == "" {
+				fmt.Println("FAILED")
+				fmt.Println("  Error: no manifest.yaml found (use --manifest)")
+				failed++
+				continue
+			}
+			if fileAlbum = loaded[dir]; fileAlbum == nil {
+				if fileAlbum, err = id3.LoadAlbum(dir); err != nil {
+					return err
+				}
+				loaded[dir] = fileAlbum
+			}
+		}
+
+		tag, ok := fileAlbum.TrackTag(file)
+		if !ok {
+			fmt.Println("SKIPPED (no matching track)")
+			continue
+		}
+		if err := id3.WriteFile(file, tag); err != nil {
+			fmt.Println("FAILED")
+			fmt.Printf("  Error: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s (track %d/%d)\n", tag.Title, tag.Track, tag.TrackTotal)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) could not be tagged", failed)
+	}
+	return nil
+}
+
+// loadAlbum loads tags from a bundle directory or its manifest.yaml
+func loadAlbum(path string) (*id3.Album, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest not found: %s", path)
+	}
+	if !info.IsDir() {
+		path = filepath.Dir(path)
+	}
+	return id3.LoadAlbum(path)
+}
+
+// expandMP3Inputs expands files and directories to a list of MP3 files. A
+// bundle directory stands for its audio/ directory.
+func expandMP3Inputs(inputs []string) ([]string, error) {
+	var files []string
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, fmt.Errorf("cannot access %s: %w", input, err)
+		}
+
+		if !info.IsDir() {
+			if !strings.EqualFold(filepath.Ext(input), ".mp3") {
+				return nil, fmt.Errorf("not an MP3 file: %s", input)
+			}
+			files = append(files, input)
+			continue
+		}
+
+		dir := input
+		if _, err := os.Stat(filepath.Join(input, "manifest.yaml")); err == nil {
+			dir = filepath.Join(input, "audio")
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read directory %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".mp3") {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
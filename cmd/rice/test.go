@@ -34,17 +34,10 @@ func testCmd() *cobra.Command {
 
 func runTest(path string, port int, openBrowser bool, playerPath string) error {
 	// Check path exists
-	info, err := os.Stat(path)
-	if err != nil {
+	if _, err := os.Stat(path); err != nil {
 		return fmt.Errorf("path not found: %s", path)
 	}
 
-	// If it's a .ricecake file, we would need to extract it first
-	// For now, only support directories
-	if !info.IsDir() {
-		return fmt.Errorf("currently only directories are supported (not .ricecake files)")
-	}
-
 	fmt.Println("Starting preview server...")
 	fmt.Println()
 	fmt.Printf("Bundle: %s\n", path)
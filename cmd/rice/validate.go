@@ -66,7 +66,7 @@ func outputText(report *validate.Report, quiet, strict bool) error {
 
 	// Group results by category
 	categories := make(map[string][]validate.Result)
-	categoryOrder := []string{"Structure", "Manifest", "Audio", "Images", "Security", "Copyright"}
+	categoryOrder := []string{"Archive", "Structure", "Size", "Manifest", "Audio", "Tracks", "Images", "Security", "Copyright"}
 
 	for _, result := range report.Results {
 		categories[result.Category] = append(categories[result.Category], result)
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davesmith10/rice-cli/internal/keyring"
+	"github.com/davesmith10/rice-cli/internal/sign"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes reported by rice verify
+const (
+	exitUnsigned  = 2
+	exitTampered  = 3
+	exitWrongKey  = 4
+	exitMalformed = 5
+	exitNoRole    = 6
+	exitKeyValid  = 7
+)
+
+func verifyCmd() *cobra.Command {
+	var pubkeyPath, requireRole string
+
+	cmd := &cobra.Command{
+		Use:   "verify [bundle]",
+		Short: "Verify the signature of a bundle",
+		Long: `Verify the Ed25519 signatures of a ricecake bundle, both those embedded
+in it and those in a detached <bundle>.sig file next to it.
+
+Every signature is listed; verification succeeds if one of
+them was made with a trusted key. Trusted keys are the keyring's keys plus
+~/.rice/public.key, or only --pubkey if given. With --require-role, that
+valid signature must also carry the given role.
+
+A signature is judged by when it was made: it must fall within the key's
+validity period and before the key's revocation took effect. The signing
+time comes from a timestamp token if one of the keyring's timestamp
+authorities issued it; otherwise it is the Created-At the signer recorded,
+which a holder of a compromised key can choose freely.
+
+Exit codes:
+  0  signature is valid
+  1  verification could not be performed
+  2  bundle is not signed
+  3  bundle contents do not match the signature
+  4  signature was made with a different key
+  5  signature is malformed
+  6  no valid signature has the required role
+  7  signature was made while the key was revoked or not valid`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify(args[0], pubkeyPath, requireRole)
+		},
+	}
+
+	cmd.Flags().StringVar(&pubkeyPath, "pubkey", "", "Trust only this public key file")
+	cmd.Flags().StringVar(&requireRole, "require-role", "", "Require a valid signature with this role (artist, label or distributor)")
+
+	return cmd
+}
+
+func runVerify(bundlePath, pubkeyPath, requireRole string) error {
+	if _, err := os.Stat(bundlePath); os.IsNotExist(err) {
+		return fmt.Errorf("bundle not found: %s", bundlePath)
+	}
+
+	if requireRole != "" {
+		if err := sign.ValidateRole(requireRole); err != nil {
+			return err
+		}
+	}
+
+	trust, err := trustedKeys(pubkeyPath)
+	if err != nil {
+		return err
+	}
+	kr, err := keyring.Open(keyring.DefaultDir())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Verifying bundle: %s\n\n", filepath.Base(bundlePath))
+
+	results, err := sign.VerifyAll(bundlePath, trust)
+	if err == nil {
+		printSignatures(results, kr)
+		var sig *sign.Signature
+		if sig, err = sign.Outcome(results, trust.Keys...); err == nil {
+			if requireRole != "" && !hasValidRole(results, requireRole) {
+				fmt.Printf("Verification FAILED: no valid signature with role %s\n", requireRole)
+				os.Exit(exitNoRole)
+			}
+			printValidSignature(results, sig)
+			return nil
+		}
+	}
+
+	code := verifyExitCode(err)
+	if code == 1 {
+		return err
+	}
+	fmt.Printf("Verification FAILED: %v\n", err)
+	var tampered *sign.TamperedError
+	if errors.As(err, &tampered) {
+		printFileList("modified", tampered.Modified)
+		printFileList("missing", tampered.Missing)
+		printFileList("extra", tampered.Extra)
+	}
+	os.Exit(code)
+	return nil
+}
+
+// printSignatures lists every signature in the bundle with its status,
+// naming signers found in the keyring
+func printSignatures(results []sign.Result, kr *keyring.Keyring) {
+	fmt.Println("Signatures:")
+	for _, r := range results {
+		role, signer := "-", "-"
+		if r.Signature != nil {
+			if r.Signature.Role != "" {
+				role = r.Signature.Role
+			}
+			if r.Signature.KeyFingerprint != "" {
+				signer = r.Signature.KeyFingerprint
+				if key := kr.Lookup(signer); key != nil {
+					signer = key.Name
+				}
+			}
+		}
+		fmt.Printf("  %-32s %-12s %-51s %s\n", r.File, role, signer, signatureStatus(r.Err))
+	}
+	fmt.Println()
+}
+
+// signatureStatus describes the outcome of checking one signature
+func signatureStatus(err error) string {
+	switch {
+	case err == nil:
+		return "valid"
+	case errors.Is(err, sign.ErrWrongKey):
+		return "untrusted key"
+	case errors.Is(err, sign.ErrTampered):
+		return "tampered"
+	case errors.Is(err, sign.ErrMalformed):
+		return "malformed"
+	case errors.Is(err, sign.ErrKeyRevoked):
+		return "revoked key"
+	case errors.Is(err, sign.ErrKeyExpired):
+		return "expired key"
+	default:
+		return "error"
+	}
+}
+
+// hasValidRole reports whether a valid signature carries role
+func hasValidRole(results []sign.Result, role string) bool {
+	for _, r := range results {
+		if r.Err == nil && r.Signature.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+func printValidSignature(results []sign.Result, sig *sign.Signature) {
+	fmt.Println("Signature is valid.")
+	fmt.Printf("  Bundle ID: %s\n", sig.BundleID)
+	if sig.Role != "" {
+		fmt.Printf("  Role:      %s\n", sig.Role)
+	}
+	for _, r := range results {
+		if r.Signature != sig || r.SignedAt.IsZero() {
+			continue
+		}
+		source := "signer's clock"
+		if r.Timestamped {
+			source = "timestamped by " + sig.Timestamp.TSAFingerprint
+		}
+		fmt.Printf("  Signed:    %s (%s)\n", r.SignedAt.Format("2006-01-02T15:04:05Z07:00"), source)
+	}
+	fmt.Printf("  Tool:      %s\n", sig.ToolVersion)
+}
+
+// printFileList prints one line per file under a status label
+func printFileList(label string, files []string) {
+	for _, name := range files {
+		fmt.Printf("  %-9s %s\n", label+":", name)
+	}
+}
+
+// verifyExitCode maps a verification error to the process exit code
+func verifyExitCode(err error) int {
+	switch {
+	case errors.Is(err, sign.ErrUnsigned):
+		return exitUnsigned
+	case errors.Is(err, sign.ErrTampered):
+		return exitTampered
+	case errors.Is(err, sign.ErrWrongKey):
+		return exitWrongKey
+	case errors.Is(err, sign.ErrMalformed):
+		return exitMalformed
+	case errors.Is(err, sign.ErrKeyRevoked), errors.Is(err, sign.ErrKeyExpired):
+		return exitKeyValid
+	default:
+		return 1
+	}
+}
+
+// defaultPublicKeyPath returns the public key written by rice keygen
+func defaultPublicKeyPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".rice", "public.key")
+}
@@ -4,9 +4,13 @@ go 1.21
 
 require (
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/crypto v0.33.0
+	golang.org/x/term v0.29.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
+require golang.org/x/sys v0.30.0 // indirect
+
 require (
 	github.com/google/uuid v1.6.0
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
@@ -0,0 +1,45 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+)
+
+func probeFLAC(r io.Reader) (*Info, error) {
+	// "fLaC" marker followed by the STREAMINFO metadata block header
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:4]) != "fLaC" {
+		return nil, fmt.Errorf("missing FLAC stream marker")
+	}
+	if head[4]&0x7F != 0 {
+		return nil, fmt.Errorf("FLAC stream does not start with STREAMINFO")
+	}
+	length := int(head[5])<<16 | int(head[6])<<8 | int(head[7])
+	if length < 34 {
+		return nil, fmt.Errorf("FLAC STREAMINFO block too short")
+	}
+
+	b := make([]byte, 34)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("truncated FLAC STREAMINFO block")
+	}
+
+	// Bytes 10-17 pack sample rate (20 bits), channels-1 (3), bits-1 (5)
+	// and total samples (36)
+	sampleRate := int(b[10])<<12 | int(b[11])<<4 | int(b[12])>>4
+	channels := int((b[12]>>1)&7) + 1
+	bitDepth := (int(b[12]&1)<<4 | int(b[13])>>4) + 1
+	totalSamples := int64(b[13]&0x0F)<<32 | int64(b[14])<<24 | int64(b[15])<<16 | int64(b[16])<<8 | int64(b[17])
+
+	if sampleRate == 0 {
+		return nil, fmt.Errorf("invalid FLAC sample rate")
+	}
+
+	return &Info{
+		Codec:      "flac",
+		Duration:   samplesToDuration(totalSamples, sampleRate),
+		BitDepth:   bitDepth,
+		SampleRate: sampleRate,
+		Channels:   channels,
+	}, nil
+}
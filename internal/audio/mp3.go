@@ -0,0 +1,226 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxSyncSearch limits how far past the ID3 tag we look for the first frame
+const maxSyncSearch = 64 * 1024
+
+var mp3Bitrates = map[[2]int][15]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mp3SampleRates = map[int][3]int{
+	1: {44100, 48000, 32000},
+	2: {22050, 24000, 16000},
+	3: {11025, 12000, 8000}, // MPEG 2.5
+}
+
+// mp3Frame is a decoded MPEG audio frame header
+type mp3Frame struct {
+	version    int // 1, 2, or 3 for MPEG 2.5
+	layer      int
+	bitrate    int // kbps
+	sampleRate int
+	padding    int
+	channels   int
+}
+
+func parseMP3Frame(h []byte) (*mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return nil, false
+	}
+
+	f := &mp3Frame{}
+	switch (h[1] >> 3) & 3 {
+	case 0:
+		f.version = 3
+	case 2:
+		f.version = 2
+	case 3:
+		f.version = 1
+	default:
+		return nil, false
+	}
+
+	f.layer = 4 - int((h[1]>>1)&3)
+	if f.layer == 4 {
+		return nil, false
+	}
+
+	bitrateIndex := int(h[2] >> 4)
+	rateIndex := int((h[2] >> 2) & 3)
+	if bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return nil, false // free format and reserved values are not supported
+	}
+
+	tableVersion := f.version
+	if tableVersion == 3 {
+		tableVersion = 2
+	}
+	f.bitrate = mp3Bitrates[[2]int{tableVersion, f.layer}][bitrateIndex]
+	f.sampleRate = mp3SampleRates[f.version][rateIndex]
+	f.padding = int((h[2] >> 1) & 1)
+
+	f.channels = 2
+	if h[3]>>6 == 3 {
+		f.channels = 1
+	}
+
+	return f, true
+}
+
+// samplesPerFrame returns the number of PCM samples each frame decodes to
+func (f *mp3Frame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// length returns the frame size in bytes, including the header
+func (f *mp3Frame) length() int {
+	if f.layer == 1 {
+		return (12*f.bitrate*1000/f.sampleRate + f.padding) * 4
+	}
+	return f.samplesPerFrame()/8*f.bitrate*1000/f.sampleRate + f.padding
+}
+
+// sideInfoSize returns the layer III side information size, which is where
+// a Xing/Info header starts after the frame header
+func (f *mp3Frame) sideInfoSize() int {
+	switch {
+	case f.version == 1 && f.channels == 1:
+		return 17
+	case f.version == 1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+func probeMP3(r io.Reader, size int64) (*Info, error) {
+	br := bufio.NewReaderSize(r, 8192)
+	offset := int64(0)
+
+	// Skip an ID3v2 tag
+	if head, err := br.Peek(10); err == nil && string(head[:3]) == "ID3" {
+		tagSize := int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 | int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F)
+		tagSize += 10
+		if head[5]&0x10 != 0 {
+			tagSize += 10 // footer
+		}
+		if _, err := br.Discard(int(tagSize)); err != nil {
+			return nil, fmt.Errorf("truncated ID3 tag")
+		}
+		offset += tagSize
+	}
+
+	// Find the first frame whose successor also syncs
+	var frame *mp3Frame
+	var data []byte
+	for skipped := 0; ; skipped++ {
+		if skipped > maxSyncSearch {
+			return nil, fmt.Errorf("no MPEG audio frame found")
+		}
+
+		head, err := br.Peek(4)
+		if err != nil {
+			return nil, fmt.Errorf("no MPEG audio frame found")
+		}
+
+		if f, ok := parseMP3Frame(head); ok {
+			n := f.length()
+			data, err = br.Peek(n + 4)
+			if err == io.EOF && len(data) >= n {
+				frame = f // single frame stream
+				break
+			}
+			if err == nil {
+				if _, ok := parseMP3Frame(data[n:]); ok {
+					frame = f
+					break
+				}
+			}
+		}
+
+		br.Discard(1)
+		offset++
+	}
+
+	info := &Info{
+		Codec:      fmt.Sprintf("mpeg%d-layer%d", frame.version, frame.layer),
+		SampleRate: frame.sampleRate,
+		Channels:   frame.channels,
+		Bitrate:    frame.bitrate,
+	}
+	if frame.version == 3 {
+		info.Codec = fmt.Sprintf("mpeg2.5-layer%d", frame.layer)
+	}
+
+	audioBytes := size - offset
+	samples := int64(frame.samplesPerFrame())
+
+	// Xing/Info header (LAME and most encoders)
+	if frame.layer == 3 {
+		pos := 4 + frame.sideInfoSize()
+		if len(data) >= pos+8 {
+			tag := string(data[pos : pos+4])
+			if tag == "Xing" || tag == "Info" {
+				flags := binary.BigEndian.Uint32(data[pos+4:])
+				p := pos + 8
+				var frames, bytes int64
+				if flags&1 != 0 && len(data) >= p+4 {
+					frames = int64(binary.BigEndian.Uint32(data[p:]))
+					p += 4
+				}
+				if flags&2 != 0 && len(data) >= p+4 {
+					bytes = int64(binary.BigEndian.Uint32(data[p:]))
+				}
+				if frames > 0 {
+					info.VBR = tag == "Xing"
+					info.Duration = samplesToDuration(frames*samples, frame.sampleRate)
+					if bytes == 0 {
+						bytes = audioBytes
+					}
+					if info.VBR {
+						info.Bitrate = int(float64(bytes*8) / info.Duration.Seconds() / 1000)
+					}
+					return info, nil
+				}
+			}
+		}
+	}
+
+	// VBRI header (Fraunhofer encoders), always 32 bytes after the header
+	if len(data) >= 4+32+18 && string(data[36:40]) == "VBRI" {
+		bytes := int64(binary.BigEndian.Uint32(data[46:]))
+		frames := int64(binary.BigEndian.Uint32(data[50:]))
+		if frames > 0 {
+			info.VBR = true
+			info.Duration = samplesToDuration(frames*samples, frame.sampleRate)
+			info.Bitrate = int(float64(bytes*8) / info.Duration.Seconds() / 1000)
+			return info, nil
+		}
+	}
+
+	// Constant bitrate: derive duration from the stream size
+	info.Duration = time.Duration(float64(audioBytes*8) / float64(frame.bitrate*1000) * float64(time.Second))
+	return info, nil
+}
@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// opusSampleRate is the rate Opus granule positions are counted in
+const opusSampleRate = 48000
+
+func probeOgg(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+
+	var info *Info
+	var serial uint32
+	var preSkip int64
+	lastGranule := int64(-1)
+
+	for page := 0; ; page++ {
+		header := make([]byte, 27)
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF && page > 0 {
+				break
+			}
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+		if string(header[:4]) != "OggS" {
+			return nil, fmt.Errorf("corrupt Ogg stream: missing page capture pattern")
+		}
+
+		granule := int64(binary.LittleEndian.Uint64(header[6:14]))
+		pageSerial := binary.LittleEndian.Uint32(header[14:18])
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(br, segments); err != nil {
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+		bodySize := 0
+		for _, s := range segments {
+			bodySize += int(s)
+		}
+
+		// The first page carries the codec identification header
+		if page == 0 {
+			body := make([]byte, bodySize)
+			if _, err := io.ReadFull(br, body); err != nil {
+				return nil, fmt.Errorf("truncated Ogg page")
+			}
+			var err error
+			info, preSkip, err = parseOggIdentification(body)
+			if err != nil {
+				return nil, err
+			}
+			serial = pageSerial
+			continue
+		}
+
+		if pageSerial == serial && granule >= 0 {
+			lastGranule = granule
+		}
+		if _, err := br.Discard(bodySize); err != nil {
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+	}
+
+	if lastGranule > 0 {
+		rate := info.SampleRate
+		if info.Codec == "opus" {
+			rate = opusSampleRate
+		}
+		info.Duration = samplesToDuration(lastGranule-preSkip, rate)
+	}
+
+	return info, nil
+}
+
+// parseOggIdentification reads a Vorbis or Opus identification packet,
+// returning the Opus pre-skip where applicable
+func parseOggIdentification(body []byte) (*Info, int64, error) {
+	switch {
+	case len(body) >= 30 && body[0] == 0x01 && string(body[1:7]) == "vorbis":
+		info := &Info{
+			Codec:      "vorbis",
+			Channels:   int(body[11]),
+			SampleRate: int(binary.LittleEndian.Uint32(body[12:16])),
+		}
+		if nominal := int32(binary.LittleEndian.Uint32(body[20:24])); nominal > 0 {
+			info.Bitrate = int(nominal / 1000)
+		}
+		return info, 0, nil
+
+	case len(body) >= 19 && string(body[:8]) == "OpusHead":
+		info := &Info{
+			Codec:      "opus",
+			Channels:   int(body[9]),
+			SampleRate: int(binary.LittleEndian.Uint32(body[12:16])),
+		}
+		if info.SampleRate == 0 {
+			info.SampleRate = opusSampleRate
+		}
+		return info, int64(binary.LittleEndian.Uint16(body[10:12])), nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported Ogg codec")
+}
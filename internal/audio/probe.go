@@ -0,0 +1,98 @@
+// Package audio inspects audio stream headers without decoding audio.
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Info describes an audio stream
+type Info struct {
+	Format     string // "mp3", "flac", "ogg" or "wav"
+	Codec      string // codec inside the container, e.g. "vorbis"
+	Duration   time.Duration
+	Bitrate    int  // kbps, average for VBR streams
+	VBR        bool // variable bitrate (MP3 only)
+	BitDepth   int  // bits per sample, 0 for lossy formats
+	SampleRate int  // Hz
+	Channels   int
+}
+
+// FormatFromExt returns the format name for a file extension, or "" if the
+// extension is not a supported audio format
+func FormatFromExt(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".mp3":
+		return "mp3"
+	case ".flac":
+		return "flac"
+	case ".ogg":
+		return "ogg"
+	case ".wav":
+		return "wav"
+	}
+	return ""
+}
+
+// Probe reads the stream headers of r. size is the total stream length in
+// bytes and is used to estimate duration and bitrate where the headers do
+// not record them.
+func Probe(r io.Reader, size int64, format string) (*Info, error) {
+	var info *Info
+	var err error
+
+	switch format {
+	case "mp3":
+		info, err = probeMP3(r, size)
+	case "flac":
+		info, err = probeFLAC(r)
+	case "ogg":
+		info, err = probeOgg(r)
+	case "wav":
+		info, err = probeWAV(r)
+	default:
+		return nil, fmt.Errorf("unsupported audio format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.Format = format
+	if info.Bitrate == 0 && info.Duration > 0 {
+		info.Bitrate = int(float64(size*8) / info.Duration.Seconds() / 1000)
+	}
+	return info, nil
+}
+
+// ProbeFile reads the stream headers of an audio file on disk
+func ProbeFile(path string) (*Info, error) {
+	format := FormatFromExt(filepath.Ext(path))
+	if format == "" {
+		return nil, fmt.Errorf("unsupported audio file: %s", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Probe(file, stat.Size(), format)
+}
+
+// samplesToDuration converts a sample count at rate Hz to a duration
+func samplesToDuration(samples int64, rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(samples) / float64(rate) * float64(time.Second))
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+func probeWAV(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(br, head); err != nil || string(head[:4]) != "RIFF" || string(head[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("missing RIFF/WAVE header")
+	}
+
+	var info *Info
+	var byteRate int
+	dataSize := int64(-1)
+
+	// Walk chunks until both fmt and data have been seen. Chunk sizes come
+	// from the file, so only the fixed part of fmt is read into memory and
+	// everything else is skipped.
+	for info == nil || dataSize < 0 {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			break
+		}
+		id := string(chunk[:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		// Chunks are padded to an even length
+		skip := size + size&1
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("WAV fmt chunk too short")
+			}
+			fmtData := make([]byte, 16)
+			if _, err := io.ReadFull(br, fmtData); err != nil {
+				return nil, fmt.Errorf("truncated WAV fmt chunk")
+			}
+			skip -= 16
+			info = &Info{
+				Codec:      wavCodec(binary.LittleEndian.Uint16(fmtData[0:2])),
+				Channels:   int(binary.LittleEndian.Uint16(fmtData[2:4])),
+				SampleRate: int(binary.LittleEndian.Uint32(fmtData[4:8])),
+				BitDepth:   int(binary.LittleEndian.Uint16(fmtData[14:16])),
+			}
+			byteRate = int(binary.LittleEndian.Uint32(fmtData[8:12]))
+			info.Bitrate = byteRate * 8 / 1000
+
+		case "data":
+			dataSize = size
+			if info != nil {
+				// Nothing after the audio is needed; a short data chunk
+				// only makes the duration an overestimate
+				continue
+			}
+		}
+
+		if _, err := io.CopyN(io.Discard, br, skip); err != nil {
+			return nil, fmt.Errorf("truncated WAV %q chunk", id)
+		}
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("WAV fmt chunk not found")
+	}
+	if dataSize < 0 {
+		return nil, fmt.Errorf("WAV data chunk not found")
+	}
+
+	if byteRate > 0 {
+		info.Duration = samplesToDuration(dataSize, byteRate)
+	}
+	return info, nil
+}
+
+// wavCodec names the WAVE format tag
+func wavCodec(tag uint16) string {
+	switch tag {
+	case 0x0001:
+		return "pcm"
+	case 0x0003:
+		return "float"
+	case 0xFFFE:
+		return "extensible"
+	default:
+		return fmt.Sprintf("0x%04x", tag)
+	}
+}
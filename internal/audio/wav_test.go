@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// riffChunk encodes a RIFF chunk, adding the pad byte after odd-sized
+// data. size overrides the recorded size if not negative.
+func riffChunk(id string, data []byte, size int64) []byte {
+	if size < 0 {
+		size = int64(len(data))
+	}
+	chunk := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(size))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// wavFile returns a RIFF/WAVE file made of chunks
+func wavFile(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// pcmFormat returns a 16-bit PCM fmt chunk body, with extra bytes after
+// the fixed fields
+func pcmFormat(channels, sampleRate int, extra int) []byte {
+	data := binary.LittleEndian.AppendUint16(nil, 1)
+	data = binary.LittleEndian.AppendUint16(data, uint16(channels))
+	data = binary.LittleEndian.AppendUint32(data, uint32(sampleRate))
+	data = binary.LittleEndian.AppendUint32(data, uint32(sampleRate*channels*2))
+	data = binary.LittleEndian.AppendUint16(data, uint16(channels*2))
+	data = binary.LittleEndian.AppendUint16(data, 16)
+	return append(data, make([]byte, extra)...)
+}
+
+func TestProbeWAV(t *testing.T) {
+	second := make([]byte, 44100*2*2)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			data: wavFile(riffChunk("fmt ", pcmFormat(2, 44100, 0), -1), riffChunk("data", second, -1)),
+		},
+		{
+			name: "odd-sized chunks before fmt and data",
+			data: wavFile(
+				riffChunk("LIST", []byte("INFOISFT\x05\x00\x00\x00rice\x00"), -1),
+				riffChunk("fmt ", pcmFormat(2, 44100, 3), -1),
+				riffChunk("junk", []byte{1}, -1),
+				riffChunk("data", second, -1),
+			),
+		},
+		{
+			name: "extended fmt chunk",
+			data: wavFile(riffChunk("fmt ", pcmFormat(2, 44100, 24), -1), riffChunk("data", second, -1)),
+		},
+		{
+			name:    "truncated RIFF header",
+			data:    []byte("RIFF\x00\x00\x00"),
+			wantErr: true,
+		},
+		{
+			name:    "truncated chunk header",
+			data:    append(wavFile(), "fmt \x10\x00"...),
+			wantErr: true,
+		},
+		{
+			name:    "truncated fmt chunk",
+			data:    wavFile(riffChunk("fmt ", pcmFormat(2, 44100, 0)[:10], 16)),
+			wantErr: true,
+		},
+		{
+			name:    "oversized fmt chunk",
+			data:    wavFile(riffChunk("fmt ", pcmFormat(2, 44100, 0), 0xFFFFFFF0), riffChunk("data", second, -1)),
+			wantErr: true,
+		},
+		{
+			name:    "oversized chunk before fmt",
+			data:    wavFile(riffChunk("LIST", nil, 0xFFFFFFFF), riffChunk("fmt ", pcmFormat(2, 44100, 0), -1)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			info, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)), "wav")
+			runtime.ReadMemStats(&after)
+
+			// Chunk sizes must not decide how much is allocated
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("allocated %d bytes", allocated)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Codec != "pcm" || info.Channels != 2 || info.SampleRate != 44100 || info.BitDepth != 16 {
+				t.Errorf("got %+v", info)
+			}
+			if info.Duration != time.Second {
+				t.Errorf("Duration = %v, want 1s", info.Duration)
+			}
+		})
+	}
+}
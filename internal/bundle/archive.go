@@ -1,33 +1,43 @@
 package bundle
 
 import (
-	"archive/zip"
-	"compress/flate"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // Builder creates ricecake bundles
 type Builder struct {
-	sourceDir  string
-	outputPath string
-	verbose    bool
+	sourceDir    string
+	outputPath   string
+	reproducible bool
+	verbose      bool
 }
 
-// NewBuilder creates a new bundle builder
-func NewBuilder(sourceDir, outputPath string, verbose bool) *Builder {
+// NewBuilder creates a new bundle builder. A reproducible builder writes
+// byte-identical bundles for identical source files.
+func NewBuilder(sourceDir, outputPath string, reproducible, verbose bool) *Builder {
 	return &Builder{
-		sourceDir:  sourceDir,
-		outputPath: outputPath,
-		verbose:    verbose,
+		sourceDir:    sourceDir,
+		outputPath:   outputPath,
+		reproducible: reproducible,
+		verbose:      verbose,
 	}
 }
 
-// Build creates the ricecake bundle
+// Build creates the ricecake bundle. It refuses to write a bundle that
+// exceeds the manifest size or file count limits.
 func (b *Builder) Build() error {
+	source := os.DirFS(b.sourceDir)
+
+	entries, err := Contents(source)
+	if err != nil {
+		return fmt.Errorf("failed to read source directory: %w", err)
+	}
+	if err := CheckLimits(entries); err != nil {
+		return err
+	}
+
 	// Create output file
 	outFile, err := os.Create(b.outputPath)
 	if err != nil {
@@ -35,83 +45,23 @@ func (b *Builder) Build() error {
 	}
 	defer outFile.Close()
 
-	// Create ZIP writer with compression level 6
-	zipWriter := zip.NewWriter(outFile)
-	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-		return flate.NewWriter(out, 6)
-	})
-	defer zipWriter.Close()
-
-	// Walk the source directory and add files
-	fileCount := 0
-	err = filepath.Walk(b.sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Get relative path
-		relPath, err := filepath.Rel(b.sourceDir, path)
-		if err != nil {
-			return err
-		}
-
-		// Skip the root directory
-		if relPath == "." {
-			return nil
-		}
-
-		// Skip README.txt files in subdirectories (they're just helpers)
-		if info.Name() == "README.txt" && filepath.Dir(relPath) != "." {
-			return nil
-		}
-
-		// Convert to forward slashes for ZIP compatibility
-		zipPath := strings.ReplaceAll(relPath, string(filepath.Separator), "/")
-
-		if info.IsDir() {
-			// Add directory entry
-			_, err = zipWriter.Create(zipPath + "/")
-			return err
+	writer := NewWriter(outFile)
+	writer.Deterministic = b.reproducible
+	if b.verbose {
+		writer.Progress = func(name string) {
+			fmt.Printf("  Adding %s\n", filepath.FromSlash(name))
 		}
+	}
 
-		// Add file
-		if b.verbose {
-			fmt.Printf("  Adding %s\n", relPath)
-		}
-
-		// Create ZIP entry with proper header
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-		header.Name = zipPath
-		header.Method = zip.Deflate
-
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
-		}
-
-		// Copy file contents
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		_, err = io.Copy(writer, file)
-		if err != nil {
-			return err
-		}
-
-		fileCount++
-		return nil
-	})
-
-	if err != nil {
+	// Walk the source directory and add files
+	if err := writer.AddFS(source); err != nil {
 		return fmt.Errorf("failed to add files to bundle: %w", err)
 	}
 
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+
 	return nil
 }
 
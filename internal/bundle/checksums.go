@@ -0,0 +1,206 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChecksumsFile is the per-file checksum index at the root of a bundle
+const ChecksumsFile = "checksums.yaml"
+
+// SignatureFile is the single signature written by earlier versions
+const SignatureFile = "signature.sig"
+
+// SignaturesDir holds one <key-id>.sig file per signer
+const SignaturesDir = "signatures"
+
+// IsSignatureFile reports whether name is a bundle signature
+func IsSignatureFile(name string) bool {
+	return name == SignatureFile || (path.Dir(name) == SignaturesDir && path.Ext(name) == ".sig")
+}
+
+// Checksums is the parsed checksums.yaml index
+type Checksums struct {
+	Version   int            `yaml:"version"`
+	Algorithm string         `yaml:"algorithm"`
+	Files     []FileChecksum `yaml:"files"`
+}
+
+// FileChecksum records the size and SHA-256 digest of one bundle file
+type FileChecksum struct {
+	Path   string `yaml:"path"`
+	Size   int64  `yaml:"size"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// ChecksumDiff lists the differences between an index and bundle files
+type ChecksumDiff struct {
+	Missing  []string // in the index but not in the bundle
+	Extra    []string // in the bundle but not in the index
+	Modified []string // present in both with different contents
+}
+
+// Empty reports whether the index matched the files exactly
+func (d *ChecksumDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Modified) == 0
+}
+
+// indexed reports whether a file is covered by the checksum index. The
+// index and signatures are excluded, since they are written after it.
+func indexed(name string) bool {
+	return name != ChecksumsFile && !IsSignatureFile(name)
+}
+
+// ComputeChecksums hashes every file the index covers, in sorted path
+// order. A source directory is hashed as the bundle built from it would
+// hold it; an archive is hashed entry by entry.
+func ComputeChecksums(fsys fs.FS) (*Checksums, error) {
+	files, err := hashFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checksums{Version: 1, Algorithm: "SHA-256"}
+	for _, file := range files {
+		if indexed(file.Path) {
+			c.Files = append(c.Files, file)
+		}
+	}
+
+	sort.Slice(c.Files, func(i, j int) bool { return c.Files[i].Path < c.Files[j].Path })
+	return c, nil
+}
+
+// hashFiles hashes the files of fsys other than the checksum index. For
+// an archive, that is every entry in its central directory, including
+// names its fs.FS view hides and repeated names, so nothing an extractor
+// could write goes unchecked.
+func hashFiles(fsys fs.FS) ([]FileChecksum, error) {
+	if a, ok := fsys.(*Archive); ok {
+		return a.hashEntries()
+	}
+
+	entries, err := Contents(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileChecksum
+	for _, entry := range entries {
+		if entry.Dir || entry.Name == ChecksumsFile {
+			continue
+		}
+		sum, size, err := hashFile(fsys, entry.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", entry.Name, err)
+		}
+		files = append(files, FileChecksum{Path: entry.Name, Size: size, SHA256: sum})
+	}
+	return files, nil
+}
+
+func hashFile(fsys fs.FS, name string) (string, int64, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// ParseChecksums parses a checksums.yaml index
+func ParseChecksums(data []byte) (*Checksums, error) {
+	var c Checksums
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ChecksumsFile, err)
+	}
+	if c.Version != 1 {
+		return nil, fmt.Errorf("unsupported %s version %d", ChecksumsFile, c.Version)
+	}
+	if c.Algorithm != "SHA-256" {
+		return nil, fmt.Errorf("unsupported %s algorithm %q", ChecksumsFile, c.Algorithm)
+	}
+	return &c, nil
+}
+
+// Marshal encodes the index. The output depends only on the file
+// contents, so rebuilding identical files reproduces it exactly.
+func (c *Checksums) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# Per-file checksums, generated by rice build. Do not edit.\n")
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Compare checks the files in fsys against the index. Every file must be
+// listed except the index itself and signature files whose contents
+// isSignature accepts; anything else is reported as extra.
+func (c *Checksums) Compare(fsys fs.FS, isSignature func(data []byte) bool) (*ChecksumDiff, error) {
+	actual, err := hashFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]FileChecksum, len(actual))
+	for _, file := range actual {
+		found[file.Path] = file
+	}
+
+	diff := &ChecksumDiff{}
+	listed := make(map[string]bool, len(c.Files))
+	for _, want := range c.Files {
+		listed[want.Path] = true
+		got, ok := found[want.Path]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, want.Path)
+		case got.Size != want.Size || got.SHA256 != want.SHA256:
+			diff.Modified = append(diff.Modified, want.Path)
+		}
+	}
+
+	// A name repeated in an archive is extra: only one copy was indexed
+	seen := make(map[string]bool, len(actual))
+	for _, file := range actual {
+		repeated := seen[file.Path]
+		seen[file.Path] = true
+		if listed[file.Path] && !repeated {
+			continue
+		}
+		if !repeated && IsSignatureFile(file.Path) {
+			data, err := fs.ReadFile(fsys, file.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+			}
+			if isSignature(data) {
+				continue
+			}
+		}
+		diff.Extra = append(diff.Extra, file.Path)
+	}
+	sort.Strings(diff.Extra)
+
+	return diff, nil
+}
@@ -0,0 +1,131 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// sourceFiles is a small bundle source, with a helper README.txt that is
+// left out of the bundle
+var sourceFiles = []struct{ name, content string }{
+	{"manifest.yaml", "bundle:\n  bundle_id: test\n"},
+	{"audio/01.mp3", "not really audio"},
+	{"liner-notes/notes.txt", "Recorded live.\n"},
+}
+
+// testSignature stands in for a parseable signature file
+const testSignature = "-----BEGIN RICECAKE SIGNATURE-----\n"
+
+func isTestSignature(data []byte) bool {
+	return strings.HasPrefix(string(data), testSignature)
+}
+
+// signedArchive returns an archive of sourceFiles with its checksum index,
+// a signature and extra entries appended in order, and the index
+func signedArchive(t *testing.T, extra ...[2]string) (*Archive, *Checksums) {
+	t.Helper()
+	source := fstest.MapFS{"images/README.txt": {Data: []byte("helper")}}
+	for _, f := range sourceFiles {
+		source[f.name] = &fstest.MapFile{Data: []byte(f.content)}
+	}
+	checksums, err := ComputeChecksums(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := checksums.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := [][2]string{{ChecksumsFile, string(index)}}
+	for _, f := range sourceFiles {
+		entries = append(entries, [2]string{f.name, f.content})
+	}
+	entries = append(entries, [2]string{"signatures/0123456789abcdef.sig", testSignature})
+	entries = append(entries, extra...)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := NewArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive, checksums
+}
+
+func TestCompareArchiveExtras(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra [][2]string
+		want  []string
+	}{
+		{"clean", nil, nil},
+		{"subdirectory README", [][2]string{{"audio/README.txt", "evil"}}, []string{"audio/README.txt"}},
+		{"unparseable signature", [][2]string{{"signatures/zz.sig", "evil"}}, []string{"signatures/zz.sig"}},
+		{"second signature", [][2]string{{"signatures/zz.sig", testSignature}}, nil},
+		{"repeated name", [][2]string{{"audio/01.mp3", "not really audio"}}, []string{"audio/01.mp3"}},
+		{"repeated index", [][2]string{{ChecksumsFile, "files: []\n"}}, []string{ChecksumsFile}},
+		{"both injections", [][2]string{
+			{"signatures/zz.sig", "evil"},
+			{"audio/README.txt", "evil"},
+		}, []string{"audio/README.txt", "signatures/zz.sig"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive, checksums := signedArchive(t, tt.extra...)
+			diff, err := checksums.Compare(archive, isTestSignature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(diff.Extra, tt.want) {
+				t.Errorf("extra = %q, want %q", diff.Extra, tt.want)
+			}
+			if len(diff.Missing) != 0 || len(diff.Modified) != 0 {
+				t.Errorf("missing %q, modified %q, want none", diff.Missing, diff.Modified)
+			}
+		})
+	}
+}
+
+func TestComputeChecksumsArchive(t *testing.T) {
+	// Signing an archive indexes every entry it holds, helper files too
+	archive, _ := signedArchive(t, [2]string{"audio/README.txt", "evil"})
+	checksums, err := ComputeChecksums(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range checksums.Files {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"audio/01.mp3", "audio/README.txt", "liner-notes/notes.txt", "manifest.yaml"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("indexed %q, want %q", paths, want)
+	}
+
+	diff, err := checksums.Compare(archive, isTestSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Errorf("diff = %+v, want empty", diff)
+	}
+}
@@ -0,0 +1,164 @@
+package bundle
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// Entry is a file or directory that goes into a bundle archive
+type Entry struct {
+	Name string
+	Dir  bool
+	Size int64
+}
+
+// Contents lists the entries a bundle built from fsys contains, in walk
+// order. README.txt files inside subdirectories are skipped, since they
+// only guide authors, and so are directories left with no files, which
+// validation would flag. The checksum index is always listed, since the
+// writer generates it; its size is only known once it exists.
+func Contents(fsys fs.FS) ([]Entry, error) {
+	var entries []Entry
+	hasIndex := false
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip the root directory
+		if name == "." {
+			return nil
+		}
+
+		// Skip README.txt files in subdirectories (they're just helpers)
+		if d.Name() == "README.txt" && path.Dir(name) != "." {
+			return nil
+		}
+
+		if name == ChecksumsFile {
+			hasIndex = true
+		}
+
+		entry := Entry{Name: name, Dir: d.IsDir()}
+		if !entry.Dir {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only directories that contain a file somewhere below them
+	hasFiles := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Dir {
+			for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+				hasFiles[dir] = true
+			}
+		}
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !entry.Dir || hasFiles[entry.Name] {
+			kept = append(kept, entry)
+		}
+	}
+	entries = kept
+
+	if !hasIndex {
+		entries = append(entries, Entry{Name: ChecksumsFile})
+	}
+	return entries, nil
+}
+
+// SizeCategory is the share of a bundle taken by one top-level directory,
+// or by the files at the root
+type SizeCategory struct {
+	Name  string
+	Size  int64
+	Files int
+}
+
+// Usage summarises the size of a set of bundle entries
+type Usage struct {
+	Entries    int
+	TotalSize  int64
+	Categories []SizeCategory // largest first
+}
+
+// MeasureUsage totals entries and groups their sizes by top-level directory
+func MeasureUsage(entries []Entry) Usage {
+	usage := Usage{Entries: len(entries)}
+
+	index := make(map[string]int)
+	for _, entry := range entries {
+		if entry.Dir {
+			continue
+		}
+		usage.TotalSize += entry.Size
+
+		category := "metadata"
+		if top, _, nested := strings.Cut(entry.Name, "/"); nested {
+			category = top
+		}
+		i, ok := index[category]
+		if !ok {
+			i = len(usage.Categories)
+			index[category] = i
+			usage.Categories = append(usage.Categories, SizeCategory{Name: category})
+		}
+		usage.Categories[i].Size += entry.Size
+		usage.Categories[i].Files++
+	}
+
+	sort.SliceStable(usage.Categories, func(i, j int) bool {
+		return usage.Categories[i].Size > usage.Categories[j].Size
+	})
+	return usage
+}
+
+// Breakdown describes the largest categories, e.g.
+// "audio 1.80 GB (95%), images 80.00 MB (4%)"
+func (u Usage) Breakdown() string {
+	var parts []string
+	for _, c := range u.Categories {
+		percent := 0
+		if u.TotalSize > 0 {
+			percent = int(c.Size * 100 / u.TotalSize)
+		}
+		parts = append(parts, fmt.Sprintf("%s %s (%d%%)", c.Name, FormatSize(c.Size), percent))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CheckLimits reports an error if a bundle holding entries would exceed
+// the manifest entry count, total size or single file limits. These are
+// the same limits OpenArchive enforces when the bundle is read back.
+func CheckLimits(entries []Entry) error {
+	usage := MeasureUsage(entries)
+
+	if usage.Entries > manifest.MaxFiles {
+		return fmt.Errorf("bundle would have %d entries, maximum is %d", usage.Entries, manifest.MaxFiles)
+	}
+	if usage.TotalSize > manifest.MaxTotalBundleSize {
+		return fmt.Errorf("bundle contents total %s, maximum is %s (%s)",
+			FormatSize(usage.TotalSize), FormatSize(manifest.MaxTotalBundleSize), usage.Breakdown())
+	}
+	for _, entry := range entries {
+		if limit := SizeLimit(entry.Name); !entry.Dir && entry.Size > limit {
+			return fmt.Errorf("%s is %s, maximum is %s", entry.Name, FormatSize(entry.Size), FormatSize(limit))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package bundle
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestContentsSkipsEmptyDirectories(t *testing.T) {
+	// The rice init layout, with liner-notes/ holding only its README.txt
+	source := fstest.MapFS{
+		"manifest.yaml":          {Data: []byte("bundle:\n  bundle_id: test\n")},
+		"README.txt":             {Data: []byte("About this album")},
+		"audio/README.txt":       {Data: []byte("helper")},
+		"audio/01.mp3":           {Data: []byte("audio")},
+		"liner-notes/README.txt": {Data: []byte("helper")},
+		"images/extra/scan.jpg":  {Data: []byte("jpeg")},
+		"video":                  {Mode: fs.ModeDir},
+	}
+	want := []Entry{
+		{Name: "README.txt", Size: 16},
+		{Name: "audio", Dir: true},
+		{Name: "audio/01.mp3", Size: 5},
+		{Name: "images", Dir: true},
+		{Name: "images/extra", Dir: true},
+		{Name: "images/extra/scan.jpg", Size: 4},
+		{Name: "manifest.yaml", Size: 26},
+		{Name: ChecksumsFile},
+	}
+
+	got, err := Contents(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Contents = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package bundle
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// CheckEntryName rejects ZIP entry names that could escape the bundle root
+func CheckEntryName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty entry name")
+	}
+	if strings.Contains(name, "\\") {
+		return fmt.Errorf("entry name contains backslashes")
+	}
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return fmt.Errorf("absolute path not allowed")
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if part == ".." {
+			return fmt.Errorf("path traversal detected")
+		}
+		if part == "" || part == "." {
+			return fmt.Errorf("entry name is not a clean relative path")
+		}
+	}
+	return nil
+}
+
+// SizeLimit returns the largest size allowed for a bundle file, based on
+// its extension. Files of unknown type get the text file limit.
+func SizeLimit(name string) int64 {
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case manifest.AllowedAudioExtensions[ext]:
+		return manifest.MaxSingleAudioFile
+	case manifest.AllowedImageExtensions[ext]:
+		return manifest.MaxSingleImageFile
+	default:
+		return manifest.MaxSingleTextFile
+	}
+}
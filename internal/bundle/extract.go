@@ -0,0 +1,222 @@
+package bundle
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// Extractor unpacks a .ricecake archive into a directory. Every entry is
+// checked before anything is written: unsafe names, duplicates, links and
+// entries over the manifest size limits all abort the extraction.
+type Extractor struct {
+	zr *zip.Reader
+
+	// Paths, if set, restricts extraction to these files and directories
+	Paths []string
+
+	// Overwrite allows replacing files that already exist in the target
+	Overwrite bool
+
+	// Progress, if set, is called with the path of each file as it is written
+	Progress func(name string)
+}
+
+// NewExtractor creates an extractor for the archive read by zr
+func NewExtractor(zr *zip.Reader) *Extractor {
+	return &Extractor{zr: zr}
+}
+
+// Extract writes the selected entries below dir, creating it if needed.
+// It returns the names of the files written.
+func (e *Extractor) Extract(dir string) ([]string, error) {
+	entries, err := e.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	var written []string
+	for _, f := range entries {
+		if f.FileInfo().IsDir() {
+			if err := mkdirInside(dir, strings.TrimSuffix(f.Name, "/")); err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		if e.Progress != nil {
+			e.Progress(f.Name)
+		}
+		if err := e.extractFile(dir, f); err != nil {
+			return written, err
+		}
+		written = append(written, f.Name)
+	}
+
+	return written, nil
+}
+
+// plan checks every entry and returns the ones selected for extraction
+func (e *Extractor) plan() ([]*zip.File, error) {
+	if len(e.zr.File) > manifest.MaxFiles {
+		return nil, fmt.Errorf("archive has %d entries, maximum is %d", len(e.zr.File), manifest.MaxFiles)
+	}
+
+	requested := make(map[string]bool)
+	for _, p := range e.Paths {
+		requested[strings.Trim(path.Clean(filepath.ToSlash(p)), "/")] = false
+	}
+
+	seen := make(map[string]bool)
+	var selected []*zip.File
+	var total uint64
+	for _, f := range e.zr.File {
+		if err := CheckEntryName(f.Name); err != nil {
+			return nil, fmt.Errorf("unsafe entry %q: %w", f.Name, err)
+		}
+
+		// Only plain files and directories may be extracted
+		mode := f.Mode()
+		if mode&fs.ModeSymlink != 0 {
+			return nil, fmt.Errorf("entry %s is a symbolic link", f.Name)
+		}
+		if !mode.IsRegular() && !mode.IsDir() {
+			return nil, fmt.Errorf("entry %s is not a regular file", f.Name)
+		}
+
+		// Case-insensitive filesystems would merge entries that differ only by case
+		clean := strings.TrimSuffix(f.Name, "/")
+		key := strings.ToLower(clean)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate entry in archive: %s", clean)
+		}
+		seen[key] = true
+
+		if !mode.IsDir() {
+			if limit := SizeLimit(clean); f.UncompressedSize64 > uint64(limit) {
+				return nil, fmt.Errorf("entry %s is %s, maximum is %s",
+					clean, FormatSize(int64(f.UncompressedSize64)), FormatSize(limit))
+			}
+			total += f.UncompressedSize64
+			if total > manifest.MaxTotalBundleSize {
+				return nil, fmt.Errorf("archive contents exceed maximum bundle size of %s",
+					FormatSize(manifest.MaxTotalBundleSize))
+			}
+		}
+
+		if len(requested) > 0 && !matchRequested(clean, requested) {
+			continue
+		}
+		selected = append(selected, f)
+	}
+
+	for p, found := range requested {
+		if !found {
+			return nil, fmt.Errorf("path not found in bundle: %s", p)
+		}
+	}
+
+	return selected, nil
+}
+
+// matchRequested reports whether name is, or lies below, a requested path,
+// marking the paths that matched
+func matchRequested(name string, requested map[string]bool) bool {
+	matched := false
+	for p := range requested {
+		if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+			requested[p] = true
+			matched = true
+		}
+	}
+	return matched
+}
+
+// extractFile writes a single entry, enforcing its size limit on the bytes
+// actually decompressed rather than trusting the header
+func (e *Extractor) extractFile(dir string, f *zip.File) error {
+	if err := mkdirInside(dir, path.Dir(f.Name)); err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, filepath.FromSlash(f.Name))
+	if info, err := os.Lstat(target); err == nil {
+		if !e.Overwrite {
+			return fmt.Errorf("%s: %w", target, fs.ErrExist)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("refusing to overwrite %s: not a regular file", target)
+		}
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", target, err)
+		}
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer src.Close()
+
+	// O_EXCL ensures a link planted after the check above is never followed
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+
+	limit := SizeLimit(f.Name)
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > limit {
+		err = fmt.Errorf("entry %s exceeds maximum size of %s", f.Name, FormatSize(limit))
+	}
+	if err != nil {
+		os.Remove(target)
+		return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+	}
+
+	return nil
+}
+
+// mkdirInside creates the slash-separated directory rel below root,
+// refusing to traverse anything that is not a real directory
+func mkdirInside(root, rel string) error {
+	if rel == "." || rel == "" {
+		return nil
+	}
+
+	current := root
+	for _, part := range strings.Split(rel, "/") {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.Mkdir(current, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", current, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s: %w", current, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("refusing to extract through %s: not a directory", current)
+		}
+	}
+
+	return nil
+}
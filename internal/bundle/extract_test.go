@@ -0,0 +1,226 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// zipEntry describes an archive entry for testArchive. Entries with a
+// declared size are stored raw with that uncompressed size in the header,
+// whatever their data.
+type zipEntry struct {
+	name     string
+	data     string
+	mode     fs.FileMode
+	declared uint64
+}
+
+// testArchive builds an archive in memory
+func testArchive(t *testing.T, entries ...zipEntry) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		var w io.Writer
+		var err error
+		if e.declared > 0 {
+			header.CRC32 = crc32.ChecksumIEEE([]byte(e.data))
+			header.CompressedSize64 = uint64(len(e.data))
+			header.UncompressedSize64 = e.declared
+			w, err = zw.CreateRaw(header)
+		} else {
+			w, err = zw.CreateHeader(header)
+		}
+		if err == nil {
+			_, err = io.WriteString(w, e.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestExtract(t *testing.T) {
+	zr := testArchive(t,
+		zipEntry{name: "manifest.yaml", data: "bundle: {}\n"},
+		zipEntry{name: "audio/", mode: fs.ModeDir | 0755},
+		zipEntry{name: "audio/01.mp3", data: "audio"},
+		zipEntry{name: "liner-notes/notes.txt", data: "notes"},
+	)
+
+	dir := t.TempDir()
+	e := NewExtractor(zr)
+	e.Paths = []string{"audio"}
+	written, err := e.Extract(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"audio/01.mp3"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("written = %q, want %q", written, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.yaml")); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("file outside the requested paths was extracted")
+	}
+
+	e.Paths = nil
+	if _, err := e.Extract(dir); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("extracting over existing files: got %v, want %v", err, fs.ErrExist)
+	}
+	e.Overwrite = true
+	if _, err := e.Extract(dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "liner-notes", "notes.txt")); err != nil || string(data) != "notes" {
+		t.Errorf("notes.txt = %q, %v", data, err)
+	}
+}
+
+func TestExtractRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		// plant prepares the target directory; outside is a directory
+		// next to it that nothing may be written into
+		plant     func(t *testing.T, dir, outside string)
+		overwrite bool
+		wantErr   string
+	}{
+		{
+			name:    "parent directory",
+			entries: []zipEntry{{name: "../evil.txt", data: "x"}},
+			wantErr: "path traversal",
+		},
+		{
+			name:    "parent directory inside a path",
+			entries: []zipEntry{{name: "audio/../../evil.txt", data: "x"}},
+			wantErr: "path traversal",
+		},
+		{
+			name:    "absolute path",
+			entries: []zipEntry{{name: "/tmp/evil.txt", data: "x"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "drive letter",
+			entries: []zipEntry{{name: "C:/evil.txt", data: "x"}},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "backslashes",
+			entries: []zipEntry{{name: `..\evil.txt`, data: "x"}},
+			wantErr: "backslashes",
+		},
+		{
+			name:    "duplicate differing by case",
+			entries: []zipEntry{{name: "audio/01.mp3", data: "a"}, {name: "Audio/01.MP3", data: "b"}},
+			wantErr: "duplicate entry",
+		},
+		{
+			name:    "duplicate directory and file",
+			entries: []zipEntry{{name: "audio/", mode: fs.ModeDir | 0755}, {name: "audio", data: "x"}},
+			wantErr: "duplicate entry",
+		},
+		{
+			name:    "symbolic link entry",
+			entries: []zipEntry{{name: "audio/link", data: "../../etc/passwd", mode: fs.ModeSymlink | 0777}},
+			wantErr: "symbolic link",
+		},
+		{
+			name:    "device entry",
+			entries: []zipEntry{{name: "audio/dev", mode: fs.ModeDevice | 0644}},
+			wantErr: "not a regular file",
+		},
+		{
+			name:    "header over the size limit",
+			entries: []zipEntry{{name: "notes.txt", data: "x", declared: manifest.MaxSingleTextFile + 1}},
+			wantErr: "maximum is",
+		},
+		{
+			name:    "data larger than the header claims",
+			entries: []zipEntry{{name: "notes.txt", data: strings.Repeat("x", 1000), declared: 10}},
+			wantErr: "failed to extract notes.txt",
+		},
+		{
+			name:    "directory replaced by a symbolic link",
+			entries: []zipEntry{{name: "audio/01.mp3", data: "x"}},
+			plant: func(t *testing.T, dir, outside string) {
+				if err := os.Symlink(outside, filepath.Join(dir, "audio")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "not a directory",
+		},
+		{
+			name:    "file replaced by a symbolic link",
+			entries: []zipEntry{{name: "manifest.yaml", data: "x"}},
+			plant: func(t *testing.T, dir, outside string) {
+				if err := os.Symlink(filepath.Join(outside, "target"), filepath.Join(dir, "manifest.yaml")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			overwrite: true,
+			wantErr:   "not a regular file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir, outside := filepath.Join(root, "bundle"), filepath.Join(root, "outside")
+			for _, d := range []string{dir, outside} {
+				if err := os.Mkdir(d, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.plant != nil {
+				tt.plant(t, dir, outside)
+			}
+
+			e := NewExtractor(testArchive(t, tt.entries...))
+			e.Overwrite = tt.overwrite
+			written, err := e.Extract(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+			if len(written) > 0 {
+				t.Errorf("wrote %q", written)
+			}
+
+			// Nothing may land outside the target, nor a partial file inside
+			if entries, _ := os.ReadDir(outside); len(entries) > 0 {
+				t.Errorf("wrote %s outside the target directory", entries[0].Name())
+			}
+			if entries, _ := os.ReadDir(root); len(entries) != 2 {
+				t.Errorf("target's parent has %d entries, want 2", len(entries))
+			}
+			if tt.plant == nil {
+				if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+					t.Errorf("left %s in the target directory", entries[0].Name())
+				}
+			}
+		})
+	}
+}
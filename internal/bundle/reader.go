@@ -0,0 +1,316 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// Archive limits that guard against zip bombs
+const (
+	// MaxCompressionRatio is the largest uncompressed/compressed size ratio
+	// allowed for an entry
+	MaxCompressionRatio = 100
+
+	// ratioThreshold is the size below which the compression ratio is not
+	// checked, so small, highly repetitive text files are still accepted
+	ratioThreshold = 1024 * 1024
+)
+
+// Archive errors, distinguishable with errors.Is
+var (
+	ErrTooManyFiles     = errors.New("too many files")
+	ErrTooLarge         = errors.New("size limit exceeded")
+	ErrCompressionRatio = errors.New("compression ratio too high")
+	ErrOverlap          = errors.New("overlapping entries")
+	ErrZip64            = errors.New("unexpected ZIP64 record")
+	ErrCorrupt          = errors.New("corrupt entry")
+)
+
+// zip64ExtraID is the extra field holding ZIP64 sizes and offsets
+const zip64ExtraID = 0x0001
+
+// Archive is a .ricecake archive opened with resource limits enforced.
+// Opening it checks the central directory; reading files through its
+// fs.FS view checks the bytes actually decompressed.
+type Archive struct {
+	zr     *zip.Reader
+	files  map[string]*zip.File
+	closer io.Closer
+}
+
+// OpenArchive opens and checks the archive at path
+func OpenArchive(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	a, err := NewArchive(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.closer = f
+	return a, nil
+}
+
+// NewArchive checks the archive read from r, which has the given size
+func NewArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	if err := checkDirectoryEnd(r, size); err != nil {
+		return nil, err
+	}
+	if err := checkCentralDirectory(zr, size); err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	return &Archive{zr: zr, files: files}, nil
+}
+
+// checkCentralDirectory applies the bundle limits to the sizes declared
+// in the central directory and checks that entries do not share data
+func checkCentralDirectory(zr *zip.Reader, size int64) error {
+	if len(zr.File) > manifest.MaxFiles {
+		return fmt.Errorf("archive has %d entries, maximum is %d: %w",
+			len(zr.File), manifest.MaxFiles, ErrTooManyFiles)
+	}
+
+	type span struct {
+		name       string
+		start, end int64
+	}
+	spans := make([]span, 0, len(zr.File))
+
+	var total uint64
+	for _, f := range zr.File {
+		// Bundles are far below 4 GB, so no entry needs ZIP64 fields
+		if hasExtra(f.Extra, zip64ExtraID) {
+			return fmt.Errorf("entry %s: %w", f.Name, ErrZip64)
+		}
+
+		if f.CompressedSize64 > uint64(size) {
+			return fmt.Errorf("entry %s claims %d compressed bytes in a %d byte archive: %w",
+				f.Name, f.CompressedSize64, size, ErrCorrupt)
+		}
+		if f.Method == zip.Store && f.CompressedSize64 != f.UncompressedSize64 {
+			return fmt.Errorf("entry %s is stored but its sizes differ: %w", f.Name, ErrCorrupt)
+		}
+
+		if !f.FileInfo().IsDir() {
+			if err := checkEntrySize(f, f.UncompressedSize64); err != nil {
+				return err
+			}
+			total += f.UncompressedSize64
+			if total > manifest.MaxTotalBundleSize {
+				return fmt.Errorf("archive contents exceed %s: %w",
+					FormatSize(manifest.MaxTotalBundleSize), ErrTooLarge)
+			}
+		}
+
+		offset, err := f.DataOffset()
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", f.Name, err)
+		}
+		spans = append(spans, span{
+			name: f.Name,
+			// The local header holds at least 30 bytes plus the name
+			start: offset - int64(30+len(f.Name)),
+			end:   offset + int64(f.CompressedSize64),
+		})
+	}
+
+	// Entries sharing compressed data are the basis of overlapping zip bombs
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i, s := range spans {
+		if s.end > size {
+			return fmt.Errorf("entry %s extends past the end of the archive: %w", s.name, ErrCorrupt)
+		}
+		if i > 0 && s.start < spans[i-1].end {
+			return fmt.Errorf("entries %s and %s: %w", spans[i-1].name, s.name, ErrOverlap)
+		}
+	}
+
+	return nil
+}
+
+// checkDirectoryEnd rejects archives carrying a ZIP64 end of central
+// directory locator. Some readers prefer it over the classic record, so it
+// can make an archive list different entries in different tools.
+func checkDirectoryEnd(r io.ReaderAt, size int64) error {
+	// The end record is 22 bytes plus a comment of up to 64 KB
+	tailSize := min(size, 22+65535+20)
+	tail := make([]byte, tailSize)
+	if _, err := r.ReadAt(tail, size-tailSize); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	end := bytes.LastIndex(tail, []byte("PK\x05\x06"))
+	if end >= 20 && bytes.Equal(tail[end-20:end-16], []byte("PK\x06\x07")) {
+		return fmt.Errorf("archive end record: %w", ErrZip64)
+	}
+	return nil
+}
+
+// checkEntrySize applies the per-type size limit and the compression
+// ratio limit to n uncompressed bytes of f
+func checkEntrySize(f *zip.File, n uint64) error {
+	if limit := SizeLimit(f.Name); n > uint64(limit) {
+		return fmt.Errorf("entry %s is larger than %s: %w", f.Name, FormatSize(limit), ErrTooLarge)
+	}
+	if n > ratioThreshold && n > f.CompressedSize64*MaxCompressionRatio {
+		return fmt.Errorf("entry %s expands more than %dx: %w", f.Name, MaxCompressionRatio, ErrCompressionRatio)
+	}
+	return nil
+}
+
+// hasExtra reports whether a ZIP extra field block contains id
+func hasExtra(extra []byte, id uint16) bool {
+	for len(extra) >= 4 {
+		tag := uint16(extra[0]) | uint16(extra[1])<<8
+		size := int(extra[2]) | int(extra[3])<<8
+		if tag == id {
+			return true
+		}
+		if len(extra) < 4+size {
+			return false
+		}
+		extra = extra[4+size:]
+	}
+	return false
+}
+
+// Reader returns the underlying ZIP reader
+func (a *Archive) Reader() *zip.Reader {
+	return a.zr
+}
+
+// Open implements fs.FS. Files are read with their size limits enforced
+// on the decompressed bytes.
+func (a *Archive) Open(name string) (fs.File, error) {
+	file, err := a.zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := a.files[name]
+	if !ok || f.FileInfo().IsDir() {
+		return file, nil
+	}
+	return &limitedFile{File: file, lr: &limitedReader{r: file, f: f}}, nil
+}
+
+// Verify decompresses every entry, checking sizes and CRC-32 checksums
+func (a *Archive) Verify() error {
+	for _, f := range a.zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", f.Name, err)
+		}
+		_, err = io.Copy(io.Discard, &limitedReader{r: rc, f: f})
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashEntries hashes every file entry in the central directory except the
+// checksum index, reading it with its size limits enforced. A second
+// entry named like the index is hashed like any other file.
+func (a *Archive) hashEntries() ([]FileChecksum, error) {
+	var files []FileChecksum
+	hasIndex := false
+	for _, f := range a.zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Name == ChecksumsFile && !hasIndex {
+			hasIndex = true
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", f.Name, err)
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, &limitedReader{r: rc, f: f})
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", f.Name, err)
+		}
+		files = append(files, FileChecksum{Path: f.Name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+	return files, nil
+}
+
+// Close closes the archive file, if OpenArchive opened it
+func (a *Archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// limitedReader counts decompressed bytes as they are read and turns the
+// zip package's integrity errors into descriptive ones
+type limitedReader struct {
+	r     io.Reader
+	f     *zip.File
+	nread uint64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.nread += uint64(n)
+
+	if cerr := checkEntrySize(l.f, l.nread); cerr != nil {
+		return n, cerr
+	}
+
+	switch {
+	case errors.Is(err, zip.ErrChecksum):
+		return n, fmt.Errorf("entry %s failed its CRC-32 check: %w", l.f.Name, ErrCorrupt)
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, io.ErrUnexpectedEOF):
+		return n, fmt.Errorf("entry %s does not match its declared size: %w", l.f.Name, ErrCorrupt)
+	}
+	return n, err
+}
+
+// limitedFile is an archive file read through a limitedReader
+type limitedFile struct {
+	fs.File
+	lr *limitedReader
+}
+
+func (l *limitedFile) Read(p []byte) (int, error) {
+	return l.lr.Read(p)
+}
@@ -0,0 +1,218 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// rawEntry is an archive entry written as is: data is the compressed
+// stream and size the uncompressed size recorded in the headers
+type rawEntry struct {
+	name   string
+	method uint16
+	data   []byte
+	size   uint64
+	crc    uint32
+	extra  []byte
+}
+
+// stored returns an uncompressed entry holding data
+func stored(name string, data []byte) rawEntry {
+	return rawEntry{name: name, method: zip.Store, data: data, size: uint64(len(data)), crc: crc32.ChecksumIEEE(data)}
+}
+
+// deflated returns an entry holding data compressed, with size recorded
+// as its uncompressed size
+func deflated(t *testing.T, name string, data []byte, size uint64) rawEntry {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return rawEntry{name: name, method: zip.Deflate, data: buf.Bytes(), size: size, crc: crc32.ChecksumIEEE(data)}
+}
+
+// rawArchive writes entries to an archive in memory
+func rawArchive(t *testing.T, entries ...rawEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               e.name,
+			Method:             e.method,
+			CRC32:              e.crc,
+			CompressedSize64:   uint64(len(e.data)),
+			UncompressedSize64: e.size,
+			Extra:              e.extra,
+		})
+		if err == nil {
+			_, err = w.Write(e.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// centralHeaders returns the offsets of the central directory headers
+func centralHeaders(data []byte) []int {
+	var offsets []int
+	for i := 0; ; i++ {
+		n := bytes.Index(data[i:], []byte("PK\x01\x02"))
+		if n < 0 {
+			return offsets
+		}
+		i += n
+		offsets = append(offsets, i)
+	}
+}
+
+func TestNewArchiveLimits(t *testing.T) {
+	manyFiles := func(t *testing.T) []byte {
+		entries := make([]rawEntry, manifest.MaxFiles+1)
+		for i := range entries {
+			entries[i] = stored(fmt.Sprintf("liner-notes/%03d.txt", i), nil)
+		}
+		return rawArchive(t, entries...)
+	}
+
+	tooLargeInTotal := func(t *testing.T) []byte {
+		// Each entry is within its own limit and compression ratio
+		audio := bytes.Repeat([]byte{0}, manifest.MaxSingleAudioFile/MaxCompressionRatio+1)
+		entry := rawEntry{method: zip.Deflate, data: audio, size: manifest.MaxSingleAudioFile}
+		var entries []rawEntry
+		for i := int64(0); i <= manifest.MaxTotalBundleSize/manifest.MaxSingleAudioFile; i++ {
+			entry.name = fmt.Sprintf("audio/%02d.flac", i)
+			entries = append(entries, entry)
+		}
+		return rawArchive(t, entries...)
+	}
+
+	// A ZIP64 locator in front of the end record, marked as belonging to
+	// another disk so the zip package itself ignores it
+	zip64Locator := func(t *testing.T) []byte {
+		data := rawArchive(t, stored("manifest.yaml", []byte("bundle: {}\n")))
+		end := bytes.LastIndex(data, []byte("PK\x05\x06"))
+		locator := []byte("PK\x06\x07")
+		locator = binary.LittleEndian.AppendUint32(locator, 1)
+		locator = binary.LittleEndian.AppendUint64(locator, 0)
+		locator = binary.LittleEndian.AppendUint32(locator, 2)
+		return append(append(append([]byte(nil), data[:end]...), locator...), data[end:]...)
+	}
+
+	// Two central directory entries sharing one local entry
+	overlapping := func(t *testing.T) []byte {
+		data := rawArchive(t,
+			stored("liner-notes/a.txt", []byte("same size")),
+			stored("liner-notes/b.txt", []byte("same size")),
+		)
+		headers := centralHeaders(data)
+		copy(data[headers[1]+42:headers[1]+46], data[headers[0]+42:headers[0]+46])
+		return data
+	}
+
+	// Sizes beyond what the archive could hold
+	pastEnd := func(t *testing.T) []byte {
+		data := rawArchive(t, stored("manifest.yaml", []byte("bundle: {}\n")))
+		header := centralHeaders(data)[0]
+		binary.LittleEndian.PutUint32(data[header+20:], 1<<20)
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) []byte
+		want    error
+	}{
+		{"too many entries", manyFiles, ErrTooManyFiles},
+		{"entry over its size limit", func(t *testing.T) []byte {
+			return rawArchive(t, deflated(t, "liner-notes/notes.txt", []byte("x"), manifest.MaxSingleTextFile+1))
+		}, ErrTooLarge},
+		{"entries over the total size limit", tooLargeInTotal, ErrTooLarge},
+		{"compression ratio", func(t *testing.T) []byte {
+			return rawArchive(t, deflated(t, "audio/01.flac", []byte("x"), 50<<20))
+		}, ErrCompressionRatio},
+		{"ZIP64 extra field", func(t *testing.T) []byte {
+			entry := stored("manifest.yaml", []byte("bundle: {}\n"))
+			entry.extra = []byte{0x01, 0x00, 0x08, 0x00, 11, 0, 0, 0, 0, 0, 0, 0}
+			return rawArchive(t, entry)
+		}, ErrZip64},
+		{"ZIP64 end locator", zip64Locator, ErrZip64},
+		{"overlapping entries", overlapping, ErrOverlap},
+		{"stored entry with differing sizes", func(t *testing.T) []byte {
+			entry := stored("manifest.yaml", []byte("bundle: {}\n"))
+			entry.size = 5
+			return rawArchive(t, entry)
+		}, ErrCorrupt},
+		{"compressed size past the end", pastEnd, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.archive(t)
+			if _, err := NewArchive(bytes.NewReader(data), int64(len(data))); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveReadLimits(t *testing.T) {
+	notes := bytes.Repeat([]byte("Recorded live. "), 100)
+	tests := []struct {
+		name  string
+		entry rawEntry
+		want  error
+	}{
+		{"accurate sizes", deflated(t, "liner-notes/notes.txt", notes, uint64(len(notes))), nil},
+		{"more data than declared", deflated(t, "liner-notes/notes.txt", notes, 10), ErrCorrupt},
+		{"less data than declared", deflated(t, "liner-notes/notes.txt", notes, uint64(len(notes))+10), ErrCorrupt},
+		{"wrong CRC-32", func() rawEntry {
+			e := deflated(t, "liner-notes/notes.txt", notes, uint64(len(notes)))
+			e.crc++
+			return e
+		}(), ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := rawArchive(t, tt.entry)
+			a, err := NewArchive(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := a.Verify(); !errors.Is(err, tt.want) {
+				t.Errorf("Verify: got %v, want %v", err, tt.want)
+			}
+
+			f, err := a.Open(tt.entry.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := io.Copy(io.Discard, f); !errors.Is(err, tt.want) {
+				t.Errorf("reading through Open: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
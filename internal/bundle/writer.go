@@ -0,0 +1,242 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// minZipTime is the earliest timestamp an MS-DOS ZIP header can hold
+var minZipTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Writer builds a .ricecake archive
+type Writer struct {
+	zw *zip.Writer
+
+	// Progress, if set, is called with the path of each file as it is added
+	Progress func(name string)
+
+	// Deterministic makes identical inputs produce byte-identical archives:
+	// entries are sorted, every entry gets ModTime and fixed permissions,
+	// and no extra fields are written
+	Deterministic bool
+
+	// ModTime is the timestamp of every entry in deterministic mode. If
+	// zero, AddFS uses BuildTime of the source.
+	ModTime time.Time
+}
+
+// NewWriter creates a writer that writes a deterministic bundle to w
+func NewWriter(w io.Writer) *Writer {
+	// Create ZIP writer with compression level 6
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, 6)
+	})
+	return &Writer{zw: zw, Deterministic: true}
+}
+
+// AddFS adds every file and directory in fsys to the bundle, along with a
+// freshly generated checksums.yaml. README.txt files inside subdirectories
+// are skipped, since they only guide authors.
+func (w *Writer) AddFS(fsys fs.FS) error {
+	if w.Deterministic && w.ModTime.IsZero() {
+		w.ModTime = BuildTime(fsys)
+	}
+
+	entries, err := Contents(fsys)
+	if err != nil {
+		return err
+	}
+
+	checksums, err := ComputeChecksums(fsys)
+	if err != nil {
+		return err
+	}
+	index, err := checksums.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", ChecksumsFile, err)
+	}
+
+	if w.Deterministic {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+
+	for _, entry := range entries {
+		if entry.Dir {
+			if err := w.AddDir(entry.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Name == ChecksumsFile {
+			if err := w.AddBytes(ChecksumsFile, index); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.addFSFile(fsys, entry.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) addFSFile(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return w.AddFile(name, info, file)
+}
+
+// AddDir adds a directory entry to the bundle
+func (w *Writer) AddDir(name string) error {
+	if !w.Deterministic {
+		_, err := w.zw.Create(name + "/")
+		return err
+	}
+
+	header := w.header(name+"/", fs.ModeDir|0755)
+	header.Method = zip.Store
+	_, err := w.zw.CreateHeader(header)
+	return err
+}
+
+// AddFile adds a file entry to the bundle, taking its contents from r. The
+// modification time and mode of info are recorded unless the writer is
+// deterministic.
+func (w *Writer) AddFile(name string, info fs.FileInfo, r io.Reader) error {
+	if w.Progress != nil {
+		w.Progress(name)
+	}
+
+	// Create ZIP entry with proper header
+	var header *zip.FileHeader
+	if w.Deterministic {
+		header = w.header(name, 0644)
+	} else {
+		var err error
+		header, err = zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+	}
+	header.Method = zip.Deflate
+
+	writer, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// Copy file contents
+	if _, err := io.Copy(writer, r); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// AddBytes adds a file entry holding data
+func (w *Writer) AddBytes(name string, data []byte) error {
+	info := memFileInfo{name: path.Base(name), size: int64(len(data)), modTime: time.Now()}
+	return w.AddFile(name, info, bytes.NewReader(data))
+}
+
+// Copy adds an entry from another archive without recompressing it,
+// keeping its original header
+func (w *Writer) Copy(f *zip.File) error {
+	if w.Progress != nil && !f.FileInfo().IsDir() {
+		w.Progress(f.Name)
+	}
+	return w.zw.Copy(f)
+}
+
+// header returns a normalized header for deterministic mode. Only the
+// MS-DOS date and time fields are set, so the writer adds no extended
+// timestamp extra field.
+func (w *Writer) header(name string, mode fs.FileMode) *zip.FileHeader {
+	header := &zip.FileHeader{Name: name}
+	header.SetMode(mode)
+	header.ModifiedDate, header.ModifiedTime = msDosTime(w.ModTime)
+	return header
+}
+
+// Close finishes writing the archive. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+// memFileInfo describes an in-memory file added with AddBytes
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return 0644 }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+// BuildTime returns the timestamp used for entries in a deterministic
+// build: SOURCE_DATE_EPOCH if set, otherwise bundle.created_at from the
+// manifest in fsys, otherwise 1980-01-01
+func BuildTime(fsys fs.FS) time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if seconds, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return clampZipTime(time.Unix(seconds, 0))
+		}
+	}
+
+	data, err := fs.ReadFile(fsys, "manifest.yaml")
+	if err == nil {
+		var m struct {
+			Bundle struct {
+				CreatedAt time.Time `yaml:"created_at"`
+			} `yaml:"bundle"`
+		}
+		if yaml.Unmarshal(data, &m) == nil && !m.Bundle.CreatedAt.IsZero() {
+			return clampZipTime(m.Bundle.CreatedAt)
+		}
+	}
+
+	return minZipTime
+}
+
+func clampZipTime(t time.Time) time.Time {
+	t = t.UTC()
+	if t.Before(minZipTime) {
+		return minZipTime
+	}
+	return t
+}
+
+// msDosTime encodes t in the MS-DOS date and time format used by ZIP
+// headers, which has two second resolution
+func msDosTime(t time.Time) (date, clock uint16) {
+	t = clampZipTime(t)
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
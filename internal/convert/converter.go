@@ -1,44 +1,83 @@
 package convert
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/davesmith10/rice-cli/internal/flac"
+	"github.com/davesmith10/rice-cli/internal/id3"
+)
+
+// Output formats
+const (
+	FormatMP3  = "mp3"
+	FormatFLAC = "flac"
 )
 
-// Converter handles WAV to MP3 conversion
+// Converter handles WAV to MP3 or FLAC conversion
 type Converter struct {
-	InputFiles []string
-	OutputDir  string
-	Bitrate    int  // CBR: 128, 192, 256, 320
-	Quality    int  // VBR: 0-9, -1 means use CBR
-	Force      bool
-	Verbose    bool
+	InputFiles       []string
+	OutputDir        string
+	Format           string // FormatMP3 or FormatFLAC
+	Bitrate          int    // MP3 CBR: 128, 192, 256, 320
+	Quality          int    // MP3 VBR: 0-9, -1 means use CBR
+	CompressionLevel int    // FLAC: 0-8, higher is smaller and slower
+	Force            bool
+	Verbose          bool
+	Jobs             int // Files converted at once, 0 means one per CPU
+
+	// Tags writes tags and cover art from the bundle manifest: ID3 for MP3,
+	// Vorbis comments for FLAC. Album is the bundle to take them from; if
+	// nil, each input's bundle is found with id3.FindAlbumDir.
+	Tags  bool
+	Album *id3.Album
 }
 
+// ErrOutputExists reports an output file that exists when Force is not set
+var ErrOutputExists = errors.New("output file already exists (use --force to overwrite)")
+
 // ConvertResult represents the result of a single file conversion
 type ConvertResult struct {
 	InputPath  string
 	OutputPath string
 	Success    bool
 	Error      error
+	Duration   time.Duration
+	Tagged     bool
 }
 
 // NewConverter creates a new converter instance
 func NewConverter(inputs []string, outputDir string, bitrate, quality int, force, verbose bool) *Converter {
 	return &Converter{
-		InputFiles: inputs,
-		OutputDir:  outputDir,
-		Bitrate:    bitrate,
-		Quality:    quality,
-		Force:      force,
-		Verbose:    verbose,
+		InputFiles:       inputs,
+		OutputDir:        outputDir,
+		Format:           FormatMP3,
+		Bitrate:          bitrate,
+		Quality:          quality,
+		CompressionLevel: flac.DefaultLevel,
+		Force:            force,
+		Verbose:          verbose,
 	}
 }
 
 // Convert performs the conversion of all input files
 func (c *Converter) Convert() ([]ConvertResult, error) {
+	return c.ConvertContext(context.Background())
+}
+
+// ConvertContext converts the input files, running up to Jobs
+// conversions at once. Progress is printed in input order, and results are
+// returned in input order. If ctx is cancelled, running conversions are
+// stopped, their partial output is removed, files not yet converted are
+// reported as cancelled, and ctx.Err() is returned with the results.
+func (c *Converter) ConvertContext(ctx context.Context) ([]ConvertResult, error) {
 	// Expand inputs to get all WAV files
 	wavFiles, err := c.expandInputs()
 	if err != nil {
@@ -49,41 +88,203 @@ func (c *Converter) Convert() ([]ConvertResult, error) {
 		return nil, fmt.Errorf("no WAV files found")
 	}
 
-	// Initialize LAME runner
-	lame, err := NewLameRunner()
+	// FLAC is encoded in-process; MP3 needs the embedded LAME binary
+	var lame *LameRunner
+	if c.Format != FormatFLAC {
+		lame, err = NewLameRunner()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize LAME: %w", err)
+		}
+		defer lame.Cleanup()
+	}
+
+	albums, err := c.albums(wavFiles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize LAME: %w", err)
+		return nil, err
 	}
-	defer lame.Cleanup()
 
 	// Determine mode string for output
 	modeStr := c.getModeString()
+	jobs := c.jobs(len(wavFiles))
 
-	fmt.Println("Converting WAV files to MP3...")
+	fmt.Printf("Converting WAV files to %s...\n", strings.ToUpper(c.extension()))
+	if c.Verbose {
+		fmt.Printf("Running %d conversion(s) at once\n", jobs)
+	}
 	fmt.Println()
 
-	results := make([]ConvertResult, 0, len(wavFiles))
-	successCount := 0
-	failCount := 0
+	start := time.Now()
+	total := len(wavFiles)
+	results := make([]ConvertResult, total)
+	finished := make([]bool, total)
 
+	// Two inputs with the same name would race for one output file
+	claimed := make(map[string]string)
 	for i, wavFile := range wavFiles {
-		result := c.convertFile(lame, wavFile, i+1, len(wavFiles), modeStr)
-		results = append(results, result)
-		if result.Success {
-			successCount++
+		outputPath := c.getOutputPath(wavFile)
+		if first, ok := claimed[outputPath]; ok {
+			results[i] = ConvertResult{
+				InputPath:  wavFile,
+				OutputPath: outputPath,
+				Error:      fmt.Errorf("same output file as %s", first),
+			}
+			finished[i] = true
+			continue
+		}
+		claimed[outputPath] = wavFile
+	}
+
+	indexes := make(chan int)
+	done := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = c.convertFile(ctx, lame, wavFiles[i], albums[i])
+				done <- i
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for i := range wavFiles {
+			if finished[i] {
+				continue
+			}
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Print each result once every file before it has been printed
+	next := 0
+	for i := range done {
+		finished[i] = true
+		for ; next < total && finished[next]; next++ {
+			c.printResult(next+1, total, results[next], modeStr, albums[next])
+		}
+	}
+
+	// Files left over were never started
+	for ; next < total; next++ {
+		if !finished[next] {
+			results[next] = ConvertResult{
+				InputPath:  wavFiles[next],
+				OutputPath: c.getOutputPath(wavFiles[next]),
+				Error:      ctx.Err(),
+			}
+		}
+		c.printResult(next+1, total, results[next], modeStr, albums[next])
+	}
+
+	c.printSummary(results, time.Since(start))
+	return results, ctx.Err()
+}
+
+// jobs returns how many files to convert at once
+func (c *Converter) jobs(files int) int {
+	jobs := c.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > files {
+		jobs = files
+	}
+	return jobs
+}
+
+// albums returns the bundle each input is tagged from, nil for inputs
+// not tagged. Bundles shared by several inputs are loaded once.
+func (c *Converter) albums(wavFiles []string) ([]*id3.Album, error) {
+	albums := make([]*id3.Album, len(wavFiles))
+	if !c.Tags {
+		return albums, nil
+	}
+
+	loaded := make(map[string]*id3.Album)
+	for i, wavFile := range wavFiles {
+		if c.Album != nil {
+			albums[i] = c.Album
+			continue
+		}
+		dir := id3.FindAlbumDir(wavFile)
+		if dir == "" {
+			continue
+		}
+		album, ok := loaded[dir]
+		if !ok {
+			var err error
+			if album, err = id3.LoadAlbum(dir); err != nil {
+				return nil, fmt.Errorf("failed to load tags from %s: %w", dir, err)
+			}
+			loaded[dir] = album
+		}
+		albums[i] = album
+	}
+	return albums, nil
+}
+
+// printResult prints the progress line for one file
+func (c *Converter) printResult(index, total int, result ConvertResult, modeStr string, album *id3.Album) {
+	inputName := filepath.Base(result.InputPath)
+	outputName := filepath.Base(result.OutputPath)
+	fmt.Printf("[%d/%d] %s → %s (%s)... ", index, total, inputName, outputName, modeStr)
+
+	switch {
+	case result.Success:
+		if c.Verbose {
+			fmt.Printf("done (%s)\n", result.Duration.Round(100*time.Millisecond))
 		} else {
+			fmt.Println("done")
+		}
+		if album != nil && !result.Tagged {
+			fmt.Printf("  Warning: no track in manifest.yaml matches %s, not tagged\n", outputName)
+		}
+	case errors.Is(result.Error, ErrOutputExists):
+		fmt.Println("SKIPPED (exists)")
+	case errors.Is(result.Error, context.Canceled):
+		fmt.Println("CANCELLED")
+	default:
+		fmt.Println("FAILED")
+		fmt.Printf("  Error: %v\n", result.Error)
+	}
+}
+
+// printSummary prints how many files were converted, failed or cancelled
+func (c *Converter) printSummary(results []ConvertResult, elapsed time.Duration) {
+	successCount, failCount, cancelCount := 0, 0, 0
+	for _, result := range results {
+		switch {
+		case result.Success:
+			successCount++
+		case errors.Is(result.Error, context.Canceled):
+			cancelCount++
+		default:
 			failCount++
 		}
 	}
 
 	fmt.Println()
-	if failCount == 0 {
-		fmt.Printf("Converted %d file(s) successfully.\n", successCount)
-	} else {
-		fmt.Printf("Converted %d of %d file(s). %d failed.\n", successCount, len(wavFiles), failCount)
+	took := elapsed.Round(100 * time.Millisecond)
+	switch {
+	case failCount == 0 && cancelCount == 0:
+		fmt.Printf("Converted %d file(s) successfully in %s.\n", successCount, took)
+	case cancelCount == 0:
+		fmt.Printf("Converted %d of %d file(s) in %s. %d failed.\n", successCount, len(results), took, failCount)
+	case failCount == 0:
+		fmt.Printf("Converted %d of %d file(s) in %s. %d cancelled.\n", successCount, len(results), took, cancelCount)
+	default:
+		fmt.Printf("Converted %d of %d file(s) in %s. %d failed, %d cancelled.\n", successCount, len(results), took, failCount, cancelCount)
 	}
-
-	return results, nil
 }
 
 // expandInputs expands input paths to a list of WAV files
@@ -119,72 +320,89 @@ func (c *Converter) expandInputs() ([]string, error) {
 	return wavFiles, nil
 }
 
-// convertFile converts a single WAV file to MP3
-func (c *Converter) convertFile(lame *LameRunner, inputPath string, index, total int, modeStr string) ConvertResult {
+// convertFile converts a single WAV file. The encoder writes to a
+// temporary file that replaces the output only once it is complete, so a
+// failed or cancelled conversion leaves no partial output behind.
+func (c *Converter) convertFile(ctx context.Context, lame *LameRunner, inputPath string, album *id3.Album) ConvertResult {
 	outputPath := c.getOutputPath(inputPath)
-	inputName := filepath.Base(inputPath)
-	outputName := filepath.Base(outputPath)
-
-	// Print progress
-	fmt.Printf("[%d/%d] %s → %s (%s)... ", index, total, inputName, outputName, modeStr)
+	result := ConvertResult{InputPath: inputPath, OutputPath: outputPath}
+	if err := ctx.Err(); err != nil {
+		result.Error = err
+		return result
+	}
 
 	// Check if output exists
 	if _, err := os.Stat(outputPath); err == nil {
 		if !c.Force {
-			fmt.Println("SKIPPED (exists)")
-			return ConvertResult{
-				InputPath:  inputPath,
-				OutputPath: outputPath,
-				Success:    false,
-				Error:      fmt.Errorf("output file already exists (use --force to overwrite)"),
-			}
+			result.Error = ErrOutputExists
+			return result
 		}
 	}
 
 	// Create output directory if needed
 	outputDir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		fmt.Println("FAILED")
-		fmt.Printf("  Error: %v\n", err)
-		return ConvertResult{
-			InputPath:  inputPath,
-			OutputPath: outputPath,
-			Success:    false,
-			Error:      err,
-		}
+		result.Error = err
+		return result
 	}
 
-	// Build LAME options
-	opts := LameOptions{
-		Bitrate: c.Bitrate,
-		Quality: c.Quality,
+	tmpFile, err := os.CreateTemp(outputDir, "."+filepath.Base(outputPath)+".*.part")
+	if err != nil {
+		result.Error = fmt.Errorf("failed to create temporary file: %w", err)
+		return result
+	}
+	tmpPath := tmpFile.Name()
+	// CreateTemp makes the file private; the output should not be
+	err = tmpFile.Chmod(0644)
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		result.Error = fmt.Errorf("failed to create temporary file: %w", err)
+		return result
+	}
+
+	var tag *id3.Tag
+	if album != nil {
+		tag, result.Tagged = album.TrackTag(outputPath)
 	}
 
 	// Run conversion
-	if err := lame.Convert(inputPath, outputPath, opts); err != nil {
-		fmt.Println("FAILED")
-		fmt.Printf("  Error: %v\n", err)
-		return ConvertResult{
-			InputPath:  inputPath,
-			OutputPath: outputPath,
-			Success:    false,
-			Error:      err,
+	start := time.Now()
+	if c.Format == FormatFLAC {
+		// FLAC tags go in the stream header, written with the audio
+		err = encodeFLAC(ctx, inputPath, tmpPath, c.CompressionLevel, tag)
+	} else {
+		opts := LameOptions{
+			Bitrate: c.Bitrate,
+			Quality: c.Quality,
+		}
+		err = lame.ConvertContext(ctx, inputPath, tmpPath, opts)
+		if err == nil && tag != nil {
+			if err = id3.WriteFile(tmpPath, tag); err != nil {
+				err = fmt.Errorf("failed to write tags: %w", err)
+			}
 		}
 	}
-
-	fmt.Println("done")
-	return ConvertResult{
-		InputPath:  inputPath,
-		OutputPath: outputPath,
-		Success:    true,
-		Error:      nil,
+	if err != nil {
+		os.Remove(tmpPath)
+		result.Error = err
+		return result
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		os.Remove(tmpPath)
+		result.Error = fmt.Errorf("failed to write %s: %w", outputPath, err)
+		return result
 	}
+
+	result.Success = true
+	result.Duration = time.Since(start)
+	return result
 }
 
 // getOutputPath determines the output path for a given input file
 func (c *Converter) getOutputPath(inputPath string) string {
 	baseName := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
-	outputName := baseName + ".mp3"
+	outputName := baseName + "." + c.extension()
 
 	if c.OutputDir != "" {
 		return filepath.Join(c.OutputDir, outputName)
@@ -192,8 +410,19 @@ func (c *Converter) getOutputPath(inputPath string) string {
 	return filepath.Join(filepath.Dir(inputPath), outputName)
 }
 
+// extension returns the output file extension, without the dot
+func (c *Converter) extension() string {
+	if c.Format == FormatFLAC {
+		return FormatFLAC
+	}
+	return FormatMP3
+}
+
 // getModeString returns a string describing the encoding mode
 func (c *Converter) getModeString() string {
+	if c.Format == FormatFLAC {
+		return fmt.Sprintf("FLAC level %d", c.CompressionLevel)
+	}
 	if c.Quality >= 0 {
 		return fmt.Sprintf("VBR V%d", c.Quality)
 	}
@@ -206,6 +435,14 @@ func isWavFile(name string) bool {
 	return ext == ".wav"
 }
 
+// ValidateFormat checks if the output format is supported
+func ValidateFormat(format string) error {
+	if format != FormatMP3 && format != FormatFLAC {
+		return fmt.Errorf("invalid format %q: must be mp3 or flac", format)
+	}
+	return nil
+}
+
 // ValidateBitrate checks if the bitrate is a valid value
 func ValidateBitrate(bitrate int) error {
 	validBitrates := []int{128, 192, 256, 320}
@@ -224,3 +461,11 @@ func ValidateQuality(quality int) error {
 	}
 	return nil
 }
+
+// ValidateCompressionLevel checks if the FLAC compression level is a valid value
+func ValidateCompressionLevel(level int) error {
+	if level < 0 || level > flac.MaxLevel {
+		return fmt.Errorf("invalid compression level %d: must be 0-%d (higher is smaller)", level, flac.MaxLevel)
+	}
+	return nil
+}
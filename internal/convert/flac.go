@@ -0,0 +1,139 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/flac"
+	"github.com/davesmith10/rice-cli/internal/id3"
+	"github.com/davesmith10/rice-cli/internal/jpeg"
+)
+
+// flacVendor names the encoder in the Vorbis comment block
+const flacVendor = "rice"
+
+// flacChunk is how many samples per channel are read from the WAV file at
+// a time
+const flacChunk = 16384
+
+// encodeFLAC encodes a WAV file as FLAC at its own sample rate and bit
+// depth. If tag is not nil, it is written as Vorbis comments and its cover
+// as a front cover picture.
+func encodeFLAC(ctx context.Context, inputPath, outputPath string, level int, tag *id3.Tag) error {
+	wav, err := openWAV(inputPath)
+	if err != nil {
+		return err
+	}
+	defer wav.Close()
+
+	format := flac.Format{
+		SampleRate: wav.SampleRate,
+		Channels:   wav.Channels,
+		BitDepth:   wav.BitDepth,
+	}
+	if wav.Samples > 0 {
+		format.Samples = wav.Samples
+	}
+	opts := flac.Options{Level: level, Vendor: flacVendor}
+	if tag != nil {
+		opts.Comments = vorbisComments(tag)
+		if opts.Picture, err = coverPicture(tag.Cover); err != nil {
+			return err
+		}
+	}
+
+	out, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	enc, err := flac.NewEncoder(out, format, opts)
+	if err != nil {
+		return err
+	}
+
+	buf := make([][]int32, wav.Channels)
+	for ch := range buf {
+		buf[ch] = make([]int32, flacChunk)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := wav.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		chunk := make([][]int32, len(buf))
+		for ch := range buf {
+			chunk[ch] = buf[ch][:n]
+		}
+		if err := enc.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// vorbisComments returns the Vorbis comments for a tag, using the field
+// names most players read
+func vorbisComments(tag *id3.Tag) []flac.Comment {
+	var comments []flac.Comment
+	add := func(name, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			comments = append(comments, flac.Comment{Name: name, Value: value})
+		}
+	}
+
+	add("TITLE", tag.Title)
+	add("ARTIST", tag.Artist)
+	add("ALBUMARTIST", tag.AlbumArtist)
+	add("ALBUM", tag.Album)
+	if tag.Track > 0 {
+		add("TRACKNUMBER", strconv.Itoa(tag.Track))
+	}
+	if tag.TrackTotal > 0 {
+		add("TRACKTOTAL", strconv.Itoa(tag.TrackTotal))
+	}
+	add("DATE", tag.Date)
+	add("GENRE", tag.Genre)
+	for _, composer := range tag.Composers {
+		add("COMPOSER", composer)
+	}
+	add("COPYRIGHT", tag.Copyright)
+	add("CATALOGNUMBER", tag.CatalogNumber)
+	return comments
+}
+
+// coverPicture returns the PICTURE block for a JPEG cover image, or nil if
+// there is none
+func coverPicture(cover []byte) (*flac.Picture, error) {
+	if len(cover) == 0 {
+		return nil, nil
+	}
+	info, err := jpeg.ReadInfo(bytes.NewReader(cover))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover image: %w", err)
+	}
+	return &flac.Picture{
+		Type:   flac.PictureFrontCover,
+		MIME:   "image/jpeg",
+		Width:  info.Width,
+		Height: info.Height,
+		Depth:  8 * info.Components,
+		Data:   cover,
+	}, nil
+}
@@ -2,12 +2,14 @@ package convert
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"time"
 )
 
 // LameOptions contains options for LAME encoding
@@ -59,14 +61,24 @@ func (l *LameRunner) Cleanup() {
 
 // Convert converts a WAV file to MP3 using LAME
 func (l *LameRunner) Convert(input, output string, opts LameOptions) error {
+	return l.ConvertContext(context.Background(), input, output, opts)
+}
+
+// ConvertContext converts a WAV file to MP3 using LAME, killing LAME if
+// ctx is cancelled. The output may then be incomplete.
+func (l *LameRunner) ConvertContext(ctx context.Context, input, output string, opts LameOptions) error {
 	args := l.buildArgs(input, output, opts)
 
-	cmd := exec.Command(l.binaryPath, args...)
+	cmd := exec.CommandContext(ctx, l.binaryPath, args...)
+	cmd.WaitDelay = time.Second
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		errMsg := stderr.String()
 		if errMsg != "" {
 			return fmt.Errorf("LAME error: %s", errMsg)
@@ -0,0 +1,194 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WAVE format tags
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavReader reads the PCM samples of a WAV file
+type wavReader struct {
+	file *os.File
+	r    *bufio.Reader
+
+	SampleRate int
+	Channels   int
+	BitDepth   int   // significant bits per sample
+	Samples    int64 // samples per channel, -1 if the data size is unknown
+
+	width     int   // bytes per sample in the file
+	shift     uint  // padding bits below the significant ones
+	remaining int64 // bytes of sample data left, -1 if unknown
+	frame     []byte
+}
+
+// openWAV opens a WAV file and reads its header up to the sample data
+func openWAV(path string) (*wavReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &wavReader{file: file, r: bufio.NewReaderSize(file, 64*1024)}
+	if err := w.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+// readHeader walks the chunks up to the data chunk
+func (w *wavReader) readHeader() error {
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(w.r, head); err != nil || string(head[:4]) != "RIFF" || string(head[8:12]) != "WAVE" {
+		return fmt.Errorf("missing RIFF/WAVE header")
+	}
+
+	haveFormat := false
+	for {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(w.r, chunk); err != nil {
+			return fmt.Errorf("WAV data chunk not found")
+		}
+		id := string(chunk[:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return fmt.Errorf("WAV fmt chunk too short")
+			}
+			fmtData := make([]byte, size)
+			if _, err := io.ReadFull(w.r, fmtData); err != nil {
+				return fmt.Errorf("truncated WAV fmt chunk")
+			}
+			if err := w.parseFormat(fmtData); err != nil {
+				return err
+			}
+			haveFormat = true
+
+		case "data":
+			if !haveFormat {
+				return fmt.Errorf("WAV data chunk comes before the fmt chunk")
+			}
+			// Streaming writers leave the size at its maximum
+			w.remaining = size
+			w.Samples = size / int64(w.Channels*w.width)
+			if size == 0xFFFFFFFF {
+				w.remaining = -1
+				w.Samples = -1
+			}
+			return nil
+
+		default:
+			if _, err := w.r.Discard(int(size)); err != nil {
+				return fmt.Errorf("truncated WAV %q chunk", id)
+			}
+		}
+
+		// Chunks are padded to an even length
+		if size%2 == 1 {
+			w.r.Discard(1)
+		}
+	}
+}
+
+// parseFormat reads the fmt chunk
+func (w *wavReader) parseFormat(data []byte) error {
+	tag := binary.LittleEndian.Uint16(data[0:2])
+	w.Channels = int(binary.LittleEndian.Uint16(data[2:4]))
+	w.SampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+	blockAlign := int(binary.LittleEndian.Uint16(data[12:14]))
+	containerBits := int(binary.LittleEndian.Uint16(data[14:16]))
+	w.BitDepth = containerBits
+
+	if tag == wavFormatExtensible {
+		if len(data) < 40 {
+			return fmt.Errorf("WAV extensible fmt chunk too short")
+		}
+		if valid := int(binary.LittleEndian.Uint16(data[18:20])); valid > 0 {
+			w.BitDepth = valid
+		}
+		// The sub-format GUID starts with the format tag it stands for
+		tag = binary.LittleEndian.Uint16(data[24:26])
+	}
+
+	switch tag {
+	case wavFormatPCM:
+	case wavFormatFloat:
+		return fmt.Errorf("floating-point WAV is not supported, only integer PCM")
+	default:
+		return fmt.Errorf("unsupported WAV format 0x%04x, only integer PCM", tag)
+	}
+
+	if w.Channels < 1 {
+		return fmt.Errorf("WAV has no channels")
+	}
+	w.width = (containerBits + 7) / 8
+	if w.width < 1 || w.width > 4 || blockAlign != w.Channels*w.width {
+		return fmt.Errorf("unsupported WAV sample layout: %d bits in %d-byte frames", containerBits, blockAlign)
+	}
+	if w.BitDepth < 1 || w.BitDepth > 8*w.width {
+		return fmt.Errorf("invalid WAV bit depth %d", w.BitDepth)
+	}
+	// Samples narrower than their container are stored in its high bits
+	w.shift = uint(8*w.width - w.BitDepth)
+	w.frame = make([]byte, blockAlign)
+	return nil
+}
+
+// Read reads up to len(buf[0]) samples per channel into buf, returning how
+// many it read. It returns io.EOF once the sample data is exhausted.
+func (w *wavReader) Read(buf [][]int32) (int, error) {
+	n := 0
+	for n < len(buf[0]) {
+		if w.remaining >= 0 && w.remaining < int64(len(w.frame)) {
+			break
+		}
+		if _, err := io.ReadFull(w.r, w.frame); err != nil {
+			if w.remaining < 0 && errors.Is(err, io.EOF) {
+				break
+			}
+			return n, fmt.Errorf("truncated WAV data: %w", err)
+		}
+		if w.remaining > 0 {
+			w.remaining -= int64(len(w.frame))
+		}
+
+		for ch := range buf {
+			b := w.frame[ch*w.width : (ch+1)*w.width]
+			var v int32
+			switch w.width {
+			case 1:
+				v = int32(b[0]) - 128 // 8-bit WAV is unsigned
+			case 2:
+				v = int32(int16(binary.LittleEndian.Uint16(b)))
+			case 3:
+				v = int32(uint32(b[0])|uint32(b[1])<<8|uint32(b[2])<<16) << 8 >> 8
+			case 4:
+				v = int32(binary.LittleEndian.Uint32(b))
+			}
+			buf[ch][n] = v >> w.shift
+		}
+		n++
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Close closes the file
+func (w *wavReader) Close() error {
+	return w.file.Close()
+}
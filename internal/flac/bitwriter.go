@@ -0,0 +1,123 @@
+package flac
+
+// bitWriter packs values most significant bit first, as FLAC frames are
+// laid out
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint // bits in acc not yet moved to buf, always < 8
+}
+
+// writeBits writes the low n bits of v, n <= 32
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	if n == 0 {
+		return
+	}
+	w.acc = w.acc<<n | v&(1<<n-1)
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.nbits -= 8
+		w.buf = append(w.buf, byte(w.acc>>w.nbits))
+	}
+}
+
+// writeSigned writes v as an n-bit two's complement number
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.writeBits(uint64(v), n)
+}
+
+// writeUnary writes q zero bits followed by a one bit
+func (w *bitWriter) writeUnary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		w.writeBits(0, 32)
+	}
+	w.writeBits(1, uint(q)+1)
+}
+
+// writeRice writes the zigzag-encoded residual u with Rice parameter k
+func (w *bitWriter) writeRice(u uint64, k uint) {
+	w.writeUnary(u >> k)
+	w.writeBits(u, k)
+}
+
+// writeUTF8 writes n in the UTF-8-like coding FLAC uses for frame numbers
+func (w *bitWriter) writeUTF8(n uint64) {
+	if n < 0x80 {
+		w.writeBits(n, 8)
+		return
+	}
+
+	// Continuation bytes carry 6 bits each; the lead byte carries the rest
+	bytes := uint(2)
+	for limit := uint64(0x800); n >= limit && bytes < 7; limit <<= 5 {
+		bytes++
+	}
+	lead := uint64(0xFF00>>bytes) & 0xFF
+	w.writeBits(lead|n>>(6*(bytes-1)), 8)
+	for i := int(bytes) - 2; i >= 0; i-- {
+		w.writeBits(0x80|n>>(6*uint(i))&0x3F, 8)
+	}
+}
+
+// align pads with zero bits to the next byte boundary
+func (w *bitWriter) align() {
+	if w.nbits > 0 {
+		w.writeBits(0, 8-w.nbits)
+	}
+}
+
+// bytes returns the written bytes; the writer must be aligned
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// reset empties the writer, keeping its buffer
+func (w *bitWriter) reset() {
+	w.buf = w.buf[:0]
+	w.acc = 0
+	w.nbits = 0
+}
+
+var crc8Table, crc16Table = crcTables()
+
+// crcTables builds the CRC-8 (polynomial 0x07) and CRC-16 (polynomial
+// 0x8005) tables for frame headers and frames
+func crcTables() (t8 [256]uint8, t16 [256]uint16) {
+	for i := 0; i < 256; i++ {
+		c8 := uint8(i)
+		c16 := uint16(i) << 8
+		for bit := 0; bit < 8; bit++ {
+			if c8&0x80 != 0 {
+				c8 = c8<<1 ^ 0x07
+			} else {
+				c8 <<= 1
+			}
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		t8[i] = c8
+		t16[i] = c16
+	}
+	return t8, t16
+}
+
+// crc8 returns the CRC-8 of a frame header
+func crc8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc = crc8Table[crc^b]
+	}
+	return crc
+}
+
+// crc16 returns the CRC-16 of a frame
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
@@ -0,0 +1,452 @@
+package flac
+
+// The FLAC decoder the encoder tests read their output back with. It is
+// written from the format specification rather than from the encoder, and
+// checks the CRCs of every frame.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+)
+
+// memFile is an in-memory io.WriteSeeker
+type memFile struct {
+	data []byte
+	pos  int
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos + len(p); end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	copy(f.data[f.pos:], p)
+	f.pos += len(p)
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		f.pos = int(offset)
+	case io.SeekCurrent:
+		f.pos += int(offset)
+	case io.SeekEnd:
+		f.pos = len(f.data) + int(offset)
+	}
+	return int64(f.pos), nil
+}
+
+// errTruncated is raised when the decoder reads past the end of the
+// stream. Like the other errors in the subframe decoder it is a panic,
+// which decode recovers.
+var errTruncated = errors.New("stream truncated")
+
+// bitReader reads the big-endian bit fields of a FLAC stream
+type bitReader struct {
+	data []byte
+	bit  int
+}
+
+func (r *bitReader) read(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.bit>>3 >= len(r.data) {
+			panic(errTruncated)
+		}
+		v = v<<1 | uint64(r.data[r.bit>>3]>>(7-r.bit&7)&1)
+		r.bit++
+	}
+	return v
+}
+
+func (r *bitReader) signed(n int) int64 {
+	v := int64(r.read(n))
+	if n > 0 && v&(1<<(n-1)) != 0 {
+		v -= 1 << n
+	}
+	return v
+}
+
+func (r *bitReader) unary() int {
+	n := 0
+	for r.read(1) == 0 {
+		n++
+	}
+	return n
+}
+
+func (r *bitReader) utf8() uint64 {
+	b := r.read(8)
+	if b < 0x80 {
+		return b
+	}
+	n := 0
+	for b&(0x80>>n) != 0 {
+		n++
+	}
+	v := b & (0xFF >> (n + 1))
+	for i := 1; i < n; i++ {
+		v = v<<6 | r.read(8)&0x3F
+	}
+	return v
+}
+
+// refCRC8 and refCRC16 compute the frame checksums bit by bit, independent
+// of the encoder's tables
+func refCRC8(data []byte) byte {
+	var c byte
+	for _, b := range data {
+		c ^= b
+		for i := 0; i < 8; i++ {
+			if c&0x80 != 0 {
+				c = c<<1 ^ 0x07
+			} else {
+				c <<= 1
+			}
+		}
+	}
+	return c
+}
+
+func refCRC16(data []byte) uint16 {
+	var c uint16
+	for _, b := range data {
+		c ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if c&0x8000 != 0 {
+				c = c<<1 ^ 0x8005
+			} else {
+				c <<= 1
+			}
+		}
+	}
+	return c
+}
+
+// decoded is a stream read back by decode
+type decoded struct {
+	sampleRate, channels, bitDepth int
+	totalSamples                   int64
+	minBlock, maxBlock             int
+	minFrame, maxFrame             int
+	md5                            [16]byte
+	vendor                         string
+	comments                       []string
+	picture                        []byte
+
+	samples    [][]int32
+	blockSizes []int
+	frameSizes []int
+}
+
+// decode is a minimal FLAC decoder following the format specification. It
+// checks the frame numbers, header fields and both CRCs of every frame.
+func decode(data []byte) (d *decoded, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		return nil, fmt.Errorf("missing fLaC marker")
+	}
+	d = &decoded{}
+	pos := 4
+	for last := false; !last; {
+		if pos+4 > len(data) {
+			return nil, errTruncated
+		}
+		last = data[pos]&0x80 != 0
+		kind := data[pos] & 0x7F
+		size := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		pos += 4
+		if pos+size > len(data) {
+			return nil, errTruncated
+		}
+		body := data[pos : pos+size]
+		pos += size
+
+		switch kind {
+		case blockStreamInfo:
+			d.minBlock = int(binary.BigEndian.Uint16(body[0:]))
+			d.maxBlock = int(binary.BigEndian.Uint16(body[2:]))
+			d.minFrame = int(body[4])<<16 | int(body[5])<<8 | int(body[6])
+			d.maxFrame = int(body[7])<<16 | int(body[8])<<8 | int(body[9])
+			packed := binary.BigEndian.Uint64(body[10:])
+			d.sampleRate = int(packed >> 44)
+			d.channels = int(packed>>41&7) + 1
+			d.bitDepth = int(packed>>36&31) + 1
+			d.totalSamples = int64(packed & (1<<36 - 1))
+			copy(d.md5[:], body[18:])
+		case blockVorbisComment:
+			n := binary.LittleEndian.Uint32(body)
+			d.vendor = string(body[4 : 4+n])
+			rest := body[4+n:]
+			count := binary.LittleEndian.Uint32(rest)
+			rest = rest[4:]
+			for i := uint32(0); i < count; i++ {
+				n := binary.LittleEndian.Uint32(rest)
+				d.comments = append(d.comments, string(rest[4:4+n]))
+				rest = rest[4+n:]
+			}
+		case blockPicture:
+			d.picture = body
+		}
+	}
+
+	d.samples = make([][]int32, d.channels)
+	for frame := uint64(0); pos < len(data); frame++ {
+		start := pos
+		r := &bitReader{data: data, bit: pos * 8}
+		if r.read(14) != 0x3FFE || r.read(1) != 0 || r.read(1) != 0 {
+			return nil, fmt.Errorf("frame %d: bad sync code", frame)
+		}
+		sizeCode, rateCode := r.read(4), r.read(4)
+		assignment, depthCode := int(r.read(4)), r.read(3)
+		if r.read(1) != 0 {
+			return nil, fmt.Errorf("frame %d: reserved bit set", frame)
+		}
+		if n := r.utf8(); n != frame {
+			return nil, fmt.Errorf("frame %d: numbered %d", frame, n)
+		}
+
+		var n int
+		switch {
+		case sizeCode == 1:
+			n = 192
+		case sizeCode >= 2 && sizeCode <= 5:
+			n = 576 << (sizeCode - 2)
+		case sizeCode == 6:
+			n = int(r.read(8)) + 1
+		case sizeCode == 7:
+			n = int(r.read(16)) + 1
+		case sizeCode >= 8:
+			n = 256 << (sizeCode - 8)
+		default:
+			return nil, fmt.Errorf("frame %d: reserved block size code", frame)
+		}
+
+		rates := map[uint64]int{1: 88200, 2: 176400, 3: 192000, 4: 8000, 5: 16000, 6: 22050,
+			7: 24000, 8: 32000, 9: 44100, 10: 48000, 11: 96000}
+		rate := d.sampleRate
+		switch {
+		case rates[rateCode] != 0:
+			rate = rates[rateCode]
+		case rateCode == 12:
+			rate = int(r.read(8)) * 1000
+		case rateCode == 13:
+			rate = int(r.read(16))
+		case rateCode == 14:
+			rate = int(r.read(16)) * 10
+		case rateCode != 0:
+			return nil, fmt.Errorf("frame %d: invalid sample rate code", frame)
+		}
+		if rate != d.sampleRate {
+			return nil, fmt.Errorf("frame %d: sample rate %d, stream has %d", frame, rate, d.sampleRate)
+		}
+
+		depths := map[uint64]int{0: d.bitDepth, 1: 8, 2: 12, 4: 16, 5: 20, 6: 24}
+		if depth, ok := depths[depthCode]; !ok || depth != d.bitDepth {
+			return nil, fmt.Errorf("frame %d: bit depth code %d, stream has %d bits", frame, depthCode, d.bitDepth)
+		}
+
+		if crc := byte(r.read(8)); crc != refCRC8(data[start:r.bit/8-1]) {
+			return nil, fmt.Errorf("frame %d: header CRC-8 mismatch", frame)
+		}
+
+		bps := d.bitDepth
+		var chans [][]int64
+		switch {
+		case assignment < 8:
+			if assignment+1 != d.channels {
+				return nil, fmt.Errorf("frame %d: %d channels, stream has %d", frame, assignment+1, d.channels)
+			}
+			for ch := 0; ch <= assignment; ch++ {
+				chans = append(chans, decodeSubframe(r, n, bps))
+			}
+		case assignment == 8: // left/side
+			left, side := decodeSubframe(r, n, bps), decodeSubframe(r, n, bps+1)
+			right := make([]int64, n)
+			for i := range right {
+				right[i] = left[i] - side[i]
+			}
+			chans = [][]int64{left, right}
+		case assignment == 9: // side/right
+			side, right := decodeSubframe(r, n, bps+1), decodeSubframe(r, n, bps)
+			left := make([]int64, n)
+			for i := range left {
+				left[i] = side[i] + right[i]
+			}
+			chans = [][]int64{left, right}
+		case assignment == 10: // mid/side
+			mid, side := decodeSubframe(r, n, bps), decodeSubframe(r, n, bps+1)
+			left, right := make([]int64, n), make([]int64, n)
+			for i := range mid {
+				m := mid[i]<<1 | side[i]&1
+				left[i], right[i] = (m+side[i])>>1, (m-side[i])>>1
+			}
+			chans = [][]int64{left, right}
+		default:
+			return nil, fmt.Errorf("frame %d: reserved channel assignment %d", frame, assignment)
+		}
+		if assignment >= 8 && d.channels != 2 {
+			return nil, fmt.Errorf("frame %d: stereo coding in a %d-channel stream", frame, d.channels)
+		}
+
+		r.bit = (r.bit + 7) &^ 7
+		end := r.bit / 8
+		if crc := uint16(r.read(16)); crc != refCRC16(data[start:end]) {
+			return nil, fmt.Errorf("frame %d: CRC-16 mismatch", frame)
+		}
+		pos = end + 2
+
+		for ch, samples := range chans {
+			for _, s := range samples {
+				if s < math.MinInt32 || s > math.MaxInt32 {
+					return nil, fmt.Errorf("frame %d: sample %d overflows", frame, s)
+				}
+				d.samples[ch] = append(d.samples[ch], int32(s))
+			}
+		}
+		d.blockSizes = append(d.blockSizes, n)
+		d.frameSizes = append(d.frameSizes, pos-start)
+	}
+	return d, nil
+}
+
+// fixedCoefs are the predictors of the fixed subframe orders
+var fixedCoefs = [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+// decodeSubframe decodes one channel of n samples of bps bits
+func decodeSubframe(r *bitReader, n, bps int) []int64 {
+	if r.read(1) != 0 {
+		panic(fmt.Errorf("subframe padding bit set"))
+	}
+	kind := int(r.read(6))
+	wasted := 0
+	if r.read(1) == 1 {
+		wasted = r.unary() + 1
+	}
+	bps -= wasted
+
+	samples := make([]int64, 0, n)
+	switch {
+	case kind == 0:
+		v := r.signed(bps)
+		for i := 0; i < n; i++ {
+			samples = append(samples, v)
+		}
+	case kind == 1:
+		for i := 0; i < n; i++ {
+			samples = append(samples, r.signed(bps))
+		}
+	case kind >= 8 && kind <= 12:
+		order := kind - 8
+		for i := 0; i < order; i++ {
+			samples = append(samples, r.signed(bps))
+		}
+		samples = predict(samples, decodeResidual(r, n, order), fixedCoefs[order], 0)
+	case kind >= 32:
+		order := kind - 31
+		for i := 0; i < order; i++ {
+			samples = append(samples, r.signed(bps))
+		}
+		precision := int(r.read(4)) + 1
+		if precision == 16 {
+			panic(fmt.Errorf("invalid LPC precision"))
+		}
+		shift := int(r.signed(5))
+		if shift < 0 {
+			panic(fmt.Errorf("negative LPC shift"))
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			coefs[i] = r.signed(precision)
+		}
+		samples = predict(samples, decodeResidual(r, n, order), coefs, shift)
+	default:
+		panic(fmt.Errorf("reserved subframe type %d", kind))
+	}
+
+	for i := range samples {
+		samples[i] <<= wasted
+	}
+	return samples
+}
+
+// predict appends the residual to the warm-up samples, adding the
+// prediction of coefs shifted right by shift
+func predict(samples, residual, coefs []int64, shift int) []int64 {
+	for _, res := range residual {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * samples[len(samples)-1-j]
+		}
+		samples = append(samples, res+sum>>shift)
+	}
+	return samples
+}
+
+// decodeResidual decodes the Rice-coded residual of a predicted subframe
+func decodeResidual(r *bitReader, n, order int) []int64 {
+	paramBits := 4
+	switch r.read(2) {
+	case 0:
+	case 1:
+		paramBits = 5
+	default:
+		panic(fmt.Errorf("reserved residual coding method"))
+	}
+	partitionOrder := int(r.read(4))
+	if n%(1<<partitionOrder) != 0 || n>>partitionOrder < order {
+		panic(fmt.Errorf("partition order %d invalid for %d samples", partitionOrder, n))
+	}
+
+	residual := make([]int64, 0, n-order)
+	for p := 0; p < 1<<partitionOrder; p++ {
+		count := n >> partitionOrder
+		if p == 0 {
+			count -= order
+		}
+		param := int(r.read(paramBits))
+		if param == 1<<paramBits-1 {
+			bits := int(r.read(5))
+			for i := 0; i < count; i++ {
+				residual = append(residual, r.signed(bits))
+			}
+			continue
+		}
+		for i := 0; i < count; i++ {
+			u := uint64(r.unary())<<param | r.read(param)
+			residual = append(residual, int64(u>>1)^-int64(u&1))
+		}
+	}
+	return residual
+}
+
+// TestDecodeCorrupt makes sure the CRC checks in decode catch damage, so
+// TestRoundTrip would notice frames the encoder checksums wrongly
+func TestDecodeCorrupt(t *testing.T) {
+	samples := testSignal(2, 16, 10000, 1)
+	data := encode(t, Format{SampleRate: 44100, Channels: 2, BitDepth: 16}, Options{Level: DefaultLevel}, samples)
+	if _, err := decode(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int{len(data) - 1, len(data) - 3, len(data) - 2000} {
+		corrupt := bytes.Clone(data)
+		corrupt[offset] ^= 0x10
+		if _, err := decode(corrupt); err == nil {
+			t.Errorf("flipped bit at offset %d not detected", offset)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package flac encodes PCM audio as FLAC.
+package flac
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// DefaultLevel is the compression level of the reference encoder
+const DefaultLevel = 5
+
+// MaxLevel is the highest compression level
+const MaxLevel = 8
+
+// Format describes the PCM audio given to an Encoder
+type Format struct {
+	SampleRate int // Hz
+	Channels   int
+	BitDepth   int   // bits per sample, 4-24
+	Samples    int64 // samples per channel, 0 if not known in advance
+}
+
+// Options controls compression and the metadata written ahead of the audio
+type Options struct {
+	Level    int    // compression level, 0 (fastest) to 8 (smallest)
+	Vendor   string // encoder name in the Vorbis comment block
+	Comments []Comment
+	Picture  *Picture // nil for no picture
+}
+
+// level holds the encoder settings behind a compression level
+type level struct {
+	blockSize         int
+	stereo            bool // try left/side, right/side and mid/side coding
+	maxLPCOrder       int  // 0 means fixed predictors only
+	maxPartitionOrder int
+	exhaustive        bool // encode every LPC order rather than estimate
+}
+
+// levels mirrors the trade-offs of the reference encoder's -0 to -8
+var levels = [MaxLevel + 1]level{
+	{blockSize: 1152, maxPartitionOrder: 3},
+	{blockSize: 1152, stereo: true, maxPartitionOrder: 3},
+	{blockSize: 1152, stereo: true, maxPartitionOrder: 4},
+	{blockSize: 4096, maxLPCOrder: 6, maxPartitionOrder: 4},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartitionOrder: 4},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartitionOrder: 5},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartitionOrder: 6},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 12, maxPartitionOrder: 6, exhaustive: true},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 12, maxPartitionOrder: 8, exhaustive: true},
+}
+
+// ErrClosed reports a write to an encoder that has been closed
+var ErrClosed = errors.New("flac: encoder is closed")
+
+// Encoder writes a FLAC stream. Samples are buffered into blocks and each
+// full block is written as a frame; Close writes the last, short block and
+// fills in the stream's size, frame sizes and MD5 signature.
+type Encoder struct {
+	w       io.WriteSeeker
+	format  Format
+	level   level
+	infoPos int64 // offset of the STREAMINFO block body
+
+	pending [][]int32 // samples per channel not yet encoded
+	frame   uint64
+	written int64 // samples per channel encoded
+	info    streamInfo
+	md5     hash.Hash
+	raw     []byte // scratch space for hashing samples
+	bw      bitWriter
+	windows map[int][]float64
+	closed  bool
+}
+
+// NewEncoder writes the FLAC stream header and metadata to w and returns
+// an encoder for the audio. w must be seekable so that Close can complete
+// the STREAMINFO block.
+func NewEncoder(w io.WriteSeeker, format Format, opts Options) (*Encoder, error) {
+	if err := validateFormat(format); err != nil {
+		return nil, err
+	}
+	if opts.Level < 0 || opts.Level > MaxLevel {
+		return nil, fmt.Errorf("flac: invalid compression level %d: must be 0-%d", opts.Level, MaxLevel)
+	}
+	for _, c := range opts.Comments {
+		if !validComment(c.Name) {
+			return nil, fmt.Errorf("flac: invalid Vorbis comment name %q", c.Name)
+		}
+	}
+
+	e := &Encoder{
+		w:       w,
+		format:  format,
+		level:   levels[opts.Level],
+		pending: make([][]int32, format.Channels),
+		md5:     md5.New(),
+		windows: make(map[int][]float64),
+	}
+	e.info.totalSamples = format.Samples
+
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	e.infoPos = start + 8
+
+	if _, err := io.WriteString(w, "fLaC"); err != nil {
+		return nil, err
+	}
+	if err := writeBlockHeader(w, blockStreamInfo, streamInfoSize, false); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(marshalStreamInfo(format, e.level.blockSize, e.info)); err != nil {
+		return nil, err
+	}
+
+	comments := marshalVorbisComment(opts.Vendor, opts.Comments)
+	if err := writeBlockHeader(w, blockVorbisComment, len(comments), false); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(comments); err != nil {
+		return nil, err
+	}
+
+	if opts.Picture != nil {
+		picture := marshalPicture(opts.Picture)
+		if err := writeBlockHeader(w, blockPicture, len(picture), false); err != nil {
+			return nil, fmt.Errorf("flac: picture: %w", err)
+		}
+		if _, err := w.Write(picture); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeBlockHeader(w, blockPadding, paddingSize, true); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(make([]byte, paddingSize)); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// validateFormat checks the format is one FLAC can store
+func validateFormat(f Format) error {
+	switch {
+	case f.Channels < 1 || f.Channels > 8:
+		return fmt.Errorf("flac: %d channels not supported: must be 1-8", f.Channels)
+	case f.BitDepth < 4 || f.BitDepth > 24:
+		return fmt.Errorf("flac: %d-bit audio not supported: must be 4-24 bits", f.BitDepth)
+	case f.SampleRate < 1 || f.SampleRate > 655350:
+		return fmt.Errorf("flac: sample rate %d Hz not supported", f.SampleRate)
+	case f.Samples < 0 || f.Samples >= 1<<36:
+		return fmt.Errorf("flac: invalid sample count %d", f.Samples)
+	}
+	return nil
+}
+
+// Write encodes samples, given per channel. Every channel must have the
+// same number of samples, each within the format's bit depth.
+func (e *Encoder) Write(samples [][]int32) error {
+	if e.closed {
+		return ErrClosed
+	}
+	if len(samples) != e.format.Channels {
+		return fmt.Errorf("flac: got %d channels, want %d", len(samples), e.format.Channels)
+	}
+	n := len(samples[0])
+	for _, ch := range samples[1:] {
+		if len(ch) != n {
+			return fmt.Errorf("flac: channels have different numbers of samples")
+		}
+	}
+
+	if err := e.hashSamples(samples, n); err != nil {
+		return err
+	}
+	for ch := range samples {
+		e.pending[ch] = append(e.pending[ch], samples[ch]...)
+	}
+
+	blockSize := e.level.blockSize
+	done := 0
+	for len(e.pending[0])-done >= blockSize {
+		block := make([][]int32, len(e.pending))
+		for ch := range e.pending {
+			block[ch] = e.pending[ch][done : done+blockSize]
+		}
+		if err := e.writeFrame(block); err != nil {
+			return err
+		}
+		done += blockSize
+	}
+	if done > 0 {
+		for ch := range e.pending {
+			e.pending[ch] = append(e.pending[ch][:0], e.pending[ch][done:]...)
+		}
+	}
+	return nil
+}
+
+// hashSamples adds samples to the MD5 signature of the audio: interleaved,
+// signed and little-endian, in as few bytes as the bit depth needs. It
+// also rejects samples outside the bit depth.
+func (e *Encoder) hashSamples(samples [][]int32, n int) error {
+	max := int32(1)<<(e.format.BitDepth-1) - 1
+	min := -max - 1
+	width := (e.format.BitDepth + 7) / 8
+
+	e.raw = e.raw[:0]
+	for i := 0; i < n; i++ {
+		for ch := range samples {
+			s := samples[ch][i]
+			if s < min || s > max {
+				return fmt.Errorf("flac: sample %d out of range for %d-bit audio", s, e.format.BitDepth)
+			}
+			for b := 0; b < width; b++ {
+				e.raw = append(e.raw, byte(s>>(8*b)))
+			}
+		}
+	}
+	e.md5.Write(e.raw)
+	return nil
+}
+
+// Close encodes any buffered samples and completes the STREAMINFO block.
+// It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if len(e.pending[0]) > 0 {
+		if err := e.writeFrame(e.pending); err != nil {
+			return err
+		}
+	}
+
+	if e.format.Samples > 0 && e.written != e.format.Samples {
+		return fmt.Errorf("flac: wrote %d samples per channel, expected %d", e.written, e.format.Samples)
+	}
+	e.info.totalSamples = e.written
+	copy(e.info.md5[:], e.md5.Sum(nil))
+
+	end, err := e.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := e.w.Seek(e.infoPos, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(marshalStreamInfo(e.format, e.level.blockSize, e.info)); err != nil {
+		return err
+	}
+	_, err = e.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// writeFrame encodes one block as a frame and records its size
+func (e *Encoder) writeFrame(block [][]int32) error {
+	data := e.encodeFrame(block)
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+
+	if e.info.minFrameSize == 0 || len(data) < e.info.minFrameSize {
+		e.info.minFrameSize = len(data)
+	}
+	if len(data) > e.info.maxFrameSize {
+		e.info.maxFrameSize = len(data)
+	}
+	e.written += int64(len(block[0]))
+	e.frame++
+	return nil
+}
@@ -0,0 +1,258 @@
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testSignal returns n samples per channel of bitDepth-bit audio that
+// moves between tones, noise, silence, full-scale square waves and
+// samples with wasted low bits, with the channels partly correlated
+func testSignal(channels, bitDepth, n int, seed int64) [][]int32 {
+	rng := rand.New(rand.NewSource(seed))
+	max := int64(1)<<(bitDepth-1) - 1
+	min := -max - 1
+	clamp := func(v float64) int32 {
+		s := int64(math.Round(v))
+		if s > max {
+			s = max
+		} else if s < min {
+			s = min
+		}
+		return int32(s)
+	}
+
+	samples := make([][]int32, channels)
+	for ch := range samples {
+		samples[ch] = make([]int32, n)
+	}
+	amp := float64(max)
+	for i := 0; i < n; i++ {
+		t := float64(i) / 44100
+		segment := i / 3000 % 5
+		for ch := range samples {
+			var v float64
+			switch segment {
+			case 0: // tones, with the other channels close to the first
+				v = 0.6*amp*math.Sin(2*math.Pi*440*t) + 0.2*amp*math.Sin(2*math.Pi*1234*t+float64(ch))
+			case 1: // noise
+				v = amp * (2*rng.Float64() - 1)
+			case 2: // silence
+				v = 0
+			case 3: // full-scale square wave
+				if i/50%2 == 0 {
+					v = float64(max)
+				} else {
+					v = float64(min)
+				}
+			case 4: // quieter tone in steps of 8, leaving wasted bits
+				v = 0.3 * amp * math.Sin(2*math.Pi*220*t+float64(ch)/3)
+				if bitDepth > 4 {
+					v = math.Round(v/8) * 8
+				}
+			}
+			samples[ch][i] = clamp(v)
+		}
+	}
+	return samples
+}
+
+// encode encodes samples in chunks of varying size, so frames straddle
+// the writes
+func encode(t *testing.T, format Format, opts Options, samples [][]int32) []byte {
+	t.Helper()
+	f := &memFile{}
+	enc, err := NewEncoder(f, format, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := []int{1, 1000, 4095, 4097, 7}
+	n := len(samples[0])
+	for done, i := 0, 0; done < n; i++ {
+		size := min(chunks[i%len(chunks)], n-done)
+		chunk := make([][]int32, len(samples))
+		for ch := range samples {
+			chunk[ch] = samples[ch][done : done+size]
+		}
+		if err := enc.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		done += size
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.data
+}
+
+// pcmMD5 returns the MD5 signature of samples as the format defines it
+func pcmMD5(samples [][]int32, bitDepth int) [16]byte {
+	width := (bitDepth + 7) / 8
+	var raw []byte
+	for i := range samples[0] {
+		for ch := range samples {
+			for b := 0; b < width; b++ {
+				raw = append(raw, byte(samples[ch][i]>>(8*b)))
+			}
+		}
+	}
+	return md5.Sum(raw)
+}
+
+func TestRoundTrip(t *testing.T) {
+	type testCase struct {
+		channels, bitDepth, samples, level int
+		sampleRate                         int
+		sizeKnown                          bool
+	}
+	var tests []testCase
+	for _, depth := range []int{4, 8, 12, 16, 20, 24} {
+		for _, channels := range []int{1, 2} {
+			for _, level := range []int{0, 2, 5, 8} {
+				tests = append(tests, testCase{channels, depth, 15000, level, 44100, level%2 == 0})
+			}
+		}
+	}
+	tests = append(tests,
+		testCase{3, 16, 9000, 5, 48000, true},
+		testCase{6, 24, 9000, 8, 96000, false},
+		testCase{8, 16, 5000, 1, 22050, true},
+		testCase{2, 16, 1, 5, 44100, true},    // a single sample
+		testCase{1, 24, 1, 8, 44100, false},   // a single sample, size unknown
+		testCase{2, 16, 4096, 5, 44100, true}, // exactly one block
+		testCase{2, 16, 4097, 5, 44100, true}, // one sample into the second block
+		testCase{2, 16, 1152*3 + 5, 1, 44100, false},
+		testCase{1, 16, 20000, 5, 11025, true},  // sample rate coded in the header
+		testCase{2, 20, 20000, 3, 37800, true},  // sample rate only in STREAMINFO
+		testCase{2, 16, 20000, 4, 192000, true}, // high sample rate
+	)
+
+	for _, tt := range tests {
+		name := fmt.Sprintf("%dch_%dbit_%dHz_%d_samples_level%d", tt.channels, tt.bitDepth, tt.sampleRate, tt.samples, tt.level)
+		t.Run(name, func(t *testing.T) {
+			samples := testSignal(tt.channels, tt.bitDepth, tt.samples, int64(tt.samples+tt.level))
+			format := Format{SampleRate: tt.sampleRate, Channels: tt.channels, BitDepth: tt.bitDepth}
+			if tt.sizeKnown {
+				format.Samples = int64(tt.samples)
+			}
+			data := encode(t, format, Options{Level: tt.level, Vendor: "rice"}, samples)
+
+			d, err := decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.sampleRate != tt.sampleRate || d.channels != tt.channels || d.bitDepth != tt.bitDepth {
+				t.Errorf("STREAMINFO has %d Hz, %d channels, %d bits", d.sampleRate, d.channels, d.bitDepth)
+			}
+			if d.totalSamples != int64(tt.samples) {
+				t.Errorf("STREAMINFO has %d samples, want %d", d.totalSamples, tt.samples)
+			}
+			if d.md5 != pcmMD5(samples, tt.bitDepth) {
+				t.Error("STREAMINFO MD5 does not match the input")
+			}
+			if d.md5 != pcmMD5(d.samples, tt.bitDepth) {
+				t.Error("STREAMINFO MD5 does not match the decoded audio")
+			}
+
+			blockSize := levels[tt.level].blockSize
+			if d.minBlock != blockSize || d.maxBlock != blockSize {
+				t.Errorf("STREAMINFO block sizes %d-%d, want %d", d.minBlock, d.maxBlock, blockSize)
+			}
+			for i, n := range d.blockSizes {
+				if last := i == len(d.blockSizes)-1; n != blockSize && !(last && n < blockSize) {
+					t.Errorf("frame %d has %d samples, want %d", i, n, blockSize)
+				}
+			}
+			minFrame, maxFrame := d.frameSizes[0], d.frameSizes[0]
+			for _, size := range d.frameSizes {
+				minFrame, maxFrame = min(minFrame, size), max(maxFrame, size)
+			}
+			if d.minFrame != minFrame || d.maxFrame != maxFrame {
+				t.Errorf("STREAMINFO frame sizes %d-%d, frames are %d-%d", d.minFrame, d.maxFrame, minFrame, maxFrame)
+			}
+
+			for ch := range samples {
+				if len(d.samples[ch]) != tt.samples {
+					t.Fatalf("channel %d decoded %d samples, want %d", ch, len(d.samples[ch]), tt.samples)
+				}
+				for i, want := range samples[ch] {
+					if got := d.samples[ch][i]; got != want {
+						t.Fatalf("channel %d sample %d = %d, want %d", ch, i, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	picture := &Picture{Type: PictureFrontCover, MIME: "image/jpeg", Width: 600, Height: 600, Depth: 24, Data: []byte("jpeg data")}
+	opts := Options{
+		Level:    DefaultLevel,
+		Vendor:   "rice",
+		Comments: []Comment{{"TITLE", "Ünïcode Title"}, {"ARTIST", "Someone"}, {"COMPOSER", "A"}, {"COMPOSER", "B"}},
+		Picture:  picture,
+	}
+	samples := testSignal(2, 16, 5000, 1)
+	data := encode(t, Format{SampleRate: 44100, Channels: 2, BitDepth: 16}, opts, samples)
+
+	d, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.vendor != "rice" {
+		t.Errorf("vendor = %q, want rice", d.vendor)
+	}
+	want := []string{"TITLE=Ünïcode Title", "ARTIST=Someone", "COMPOSER=A", "COMPOSER=B"}
+	if fmt.Sprint(d.comments) != fmt.Sprint(want) {
+		t.Errorf("comments = %q, want %q", d.comments, want)
+	}
+	if !bytes.Equal(d.picture, marshalPicture(picture)) {
+		t.Error("PICTURE block differs")
+	}
+	if len(d.samples[0]) != len(samples[0]) {
+		t.Errorf("decoded %d samples, want %d", len(d.samples[0]), len(samples[0]))
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	format := Format{SampleRate: 44100, Channels: 2, BitDepth: 16, Samples: 10}
+	enc, err := NewEncoder(&memFile{}, format, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Write([][]int32{{1 << 15}, {0}}); err == nil {
+		t.Error("out-of-range sample accepted")
+	}
+	if err := enc.Write([][]int32{{0, 0}, {0}}); err == nil {
+		t.Error("channels of different lengths accepted")
+	}
+	if err := enc.Write([][]int32{{0, 1, 2}, {0, 1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err == nil {
+		t.Error("Close accepted 3 of 10 declared samples")
+	}
+	if err := enc.Write([][]int32{{0}, {0}}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close: got %v, want %v", err, ErrClosed)
+	}
+
+	for _, bad := range []Format{
+		{SampleRate: 44100, Channels: 9, BitDepth: 16},
+		{SampleRate: 44100, Channels: 2, BitDepth: 32},
+		{SampleRate: 0, Channels: 2, BitDepth: 16},
+	} {
+		if _, err := NewEncoder(&memFile{}, bad, Options{}); err == nil {
+			t.Errorf("NewEncoder accepted %+v", bad)
+		}
+	}
+	if _, err := NewEncoder(&memFile{}, Format{SampleRate: 44100, Channels: 2, BitDepth: 16}, Options{Level: MaxLevel + 1}); err == nil {
+		t.Error("NewEncoder accepted level 9")
+	}
+}
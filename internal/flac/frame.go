@@ -0,0 +1,452 @@
+package flac
+
+import (
+	"math/bits"
+)
+
+// Channel assignments for stereo decorrelation in the frame header; lower
+// values give the number of independently coded channels, minus one
+const (
+	assignLeftSide  = 8
+	assignSideRight = 9
+	assignMidSide   = 10
+)
+
+// Subframe types
+const (
+	subframeConstant = iota
+	subframeVerbatim
+	subframeFixed
+	subframeLPC
+)
+
+// maxFixedOrder is the highest order of FLAC's fixed polynomial predictors
+const maxFixedOrder = 4
+
+// maxRiceParam is the largest Rice parameter of each residual coding
+// method; the next value is reserved for escaped partitions
+const (
+	maxRiceParam  = 14
+	maxRice2Param = 30
+)
+
+// subframe is one channel of a frame, analysed and ready to write
+type subframe struct {
+	kind    int
+	bps     int // bits per sample, less any wasted bits
+	wasted  int // low bits that are zero in every sample
+	samples []int32
+
+	order     int     // predictor order, fixed or LPC
+	coefs     []int32 // quantized LPC coefficients
+	precision int     // bits per LPC coefficient
+	shift     int     // right shift applied to the LPC prediction
+	residual  []int32
+	rice      riceCoding
+
+	bits int // encoded size
+}
+
+// riceCoding is the partitioned Rice coding chosen for a residual
+type riceCoding struct {
+	partitionOrder int
+	params         []int
+	rice2          bool // 5-bit parameters
+	bits           int
+}
+
+// encodeFrame encodes one block, given per channel, as a frame. The
+// returned slice is only valid until the next frame is encoded.
+func (e *Encoder) encodeFrame(block [][]int32) []byte {
+	bps := e.format.BitDepth
+	assignment := len(block) - 1
+	var subframes []*subframe
+
+	if len(block) == 2 && e.level.stereo {
+		left, right := block[0], block[1]
+		mid := make([]int32, len(left))
+		side := make([]int32, len(left))
+		for i := range left {
+			mid[i] = (left[i] + right[i]) >> 1
+			side[i] = left[i] - right[i]
+		}
+
+		// The side channel needs one more bit than the input
+		l, r := e.analyze(left, bps), e.analyze(right, bps)
+		m, s := e.analyze(mid, bps), e.analyze(side, bps+1)
+
+		subframes = []*subframe{l, r}
+		best := l.bits + r.bits
+		if l.bits+s.bits < best {
+			assignment, subframes, best = assignLeftSide, []*subframe{l, s}, l.bits+s.bits
+		}
+		if s.bits+r.bits < best {
+			assignment, subframes, best = assignSideRight, []*subframe{s, r}, s.bits+r.bits
+		}
+		if m.bits+s.bits < best {
+			assignment, subframes = assignMidSide, []*subframe{m, s}
+		}
+	} else {
+		for _, samples := range block {
+			subframes = append(subframes, e.analyze(samples, bps))
+		}
+	}
+
+	w := &e.bw
+	w.reset()
+	e.writeFrameHeader(w, len(block[0]), assignment)
+	for _, sf := range subframes {
+		sf.write(w)
+	}
+	w.align()
+	w.writeBits(uint64(crc16(w.bytes())), 16)
+	return w.bytes()
+}
+
+// writeFrameHeader writes the frame header for a block of n samples
+func (e *Encoder) writeFrameHeader(w *bitWriter, n, assignment int) {
+	sizeCode, sizeExtra, sizeBits := blockSizeCode(n)
+	rateCode, rateExtra, rateBits := sampleRateCode(e.format.SampleRate)
+
+	w.writeBits(0x3FFE, 14) // sync code
+	w.writeBits(0, 1)
+	w.writeBits(0, 1) // fixed block size: frames are numbered, not samples
+	w.writeBits(uint64(sizeCode), 4)
+	w.writeBits(uint64(rateCode), 4)
+	w.writeBits(uint64(assignment), 4)
+	w.writeBits(uint64(bitDepthCode(e.format.BitDepth)), 3)
+	w.writeBits(0, 1)
+	w.writeUTF8(e.frame)
+	w.writeBits(uint64(sizeExtra), sizeBits)
+	w.writeBits(uint64(rateExtra), rateBits)
+	w.writeBits(uint64(crc8(w.bytes())), 8)
+}
+
+// blockSizeCode returns the frame header code for a block size, and the
+// value and width of the field that follows the frame number if the code
+// alone does not give it
+func blockSizeCode(n int) (code, extra int, extraBits uint) {
+	switch n {
+	case 192:
+		return 1, 0, 0
+	case 576, 1152, 2304, 4608:
+		return 2 + bits.TrailingZeros(uint(n/576)), 0, 0
+	case 256, 512, 1024, 2048, 4096, 8192, 16384, 32768:
+		return 8 + bits.TrailingZeros(uint(n/256)), 0, 0
+	}
+	if n <= 256 {
+		return 6, n - 1, 8
+	}
+	return 7, n - 1, 16
+}
+
+// sampleRateCode returns the frame header code for a sample rate, and the
+// value and width of the field that follows the frame number if the code
+// alone does not give it
+func sampleRateCode(rate int) (code, extra int, extraBits uint) {
+	codes := map[int]int{
+		88200: 1, 176400: 2, 192000: 3, 8000: 4, 16000: 5, 22050: 6,
+		24000: 7, 32000: 8, 44100: 9, 48000: 10, 96000: 11,
+	}
+	if code, ok := codes[rate]; ok {
+		return code, 0, 0
+	}
+	switch {
+	case rate%1000 == 0 && rate/1000 <= 0xFF:
+		return 12, rate / 1000, 8
+	case rate <= 0xFFFF:
+		return 13, rate, 16
+	case rate%10 == 0 && rate/10 <= 0xFFFF:
+		return 14, rate / 10, 16
+	}
+	return 0, 0, 0 // taken from STREAMINFO
+}
+
+// bitDepthCode returns the frame header code for a bit depth, 0 meaning
+// the depth is taken from STREAMINFO
+func bitDepthCode(depth int) int {
+	switch depth {
+	case 8:
+		return 1
+	case 12:
+		return 2
+	case 16:
+		return 4
+	case 20:
+		return 5
+	case 24:
+		return 6
+	}
+	return 0
+}
+
+// analyze picks the smallest encoding of one channel of a block
+func (e *Encoder) analyze(x []int32, bps int) *subframe {
+	var or int32
+	constant := true
+	for _, s := range x {
+		or |= s
+		if s != x[0] {
+			constant = false
+		}
+	}
+	if constant {
+		return &subframe{kind: subframeConstant, bps: bps, samples: x[:1], bits: 8 + bps}
+	}
+
+	// Low bits that are zero throughout, as in 16-bit audio stored in a
+	// 24-bit file, are signalled once instead of coded in every sample
+	wasted := bits.TrailingZeros32(uint32(or))
+	if wasted > 0 {
+		shifted := make([]int32, len(x))
+		for i, s := range x {
+			shifted[i] = s >> wasted
+		}
+		x = shifted
+		bps -= wasted
+	}
+
+	best := &subframe{kind: subframeVerbatim, bps: bps, samples: x, bits: len(x) * bps}
+	if sf := e.fixedSubframe(x, bps); sf.bits < best.bits {
+		best = sf
+	}
+	if e.level.maxLPCOrder > 0 {
+		if sf := e.lpcSubframe(x, bps); sf != nil && sf.bits < best.bits {
+			best = sf
+		}
+	}
+
+	best.wasted = wasted
+	best.bits += 8 + wasted
+	return best
+}
+
+// fixedSubframe codes x with the fixed polynomial predictor that leaves
+// the smallest residual
+func (e *Encoder) fixedSubframe(x []int32, bps int) *subframe {
+	n := len(x)
+	maxOrder := maxFixedOrder
+	if maxOrder > n-1 {
+		maxOrder = n - 1
+	}
+
+	// The residual of order k is the k-th difference of the signal
+	residuals := make([][]int32, maxOrder+1)
+	residuals[0] = x
+	sums := make([]uint64, maxOrder+1)
+	for _, s := range x {
+		sums[0] += abs(s)
+	}
+	for order := 1; order <= maxOrder; order++ {
+		prev := residuals[order-1]
+		res := make([]int32, n)
+		for i := order; i < n; i++ {
+			res[i] = prev[i] - prev[i-1]
+			sums[order] += abs(res[i])
+		}
+		residuals[order] = res
+	}
+
+	// The smallest residual is nearly always the cheapest to code, so
+	// only exhaustive levels code every order
+	smallest := bestOrder(sums)
+	var best *subframe
+	for order := 0; order <= maxOrder; order++ {
+		if !e.level.exhaustive && order != smallest {
+			continue
+		}
+		residual := residuals[order][order:]
+		rice := e.riceCoding(residual, n, order)
+		sf := &subframe{
+			kind:     subframeFixed,
+			bps:      bps,
+			samples:  x,
+			order:    order,
+			residual: residual,
+			rice:     rice,
+			bits:     order*bps + rice.bits,
+		}
+		if best == nil || sf.bits < best.bits {
+			best = sf
+		}
+	}
+	return best
+}
+
+// bestOrder returns the index of the smallest sum
+func bestOrder(sums []uint64) int {
+	best := 0
+	for i, s := range sums {
+		if s < sums[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// abs returns |s| without overflowing
+func abs(s int32) uint64 {
+	if s < 0 {
+		return uint64(-int64(s))
+	}
+	return uint64(s)
+}
+
+// zigzag folds a signed residual into an unsigned one for Rice coding:
+// 0, -1, 1, -2, ... become 0, 1, 2, 3, ...
+func zigzag(r int32) uint64 {
+	return uint64(int64(r)<<1 ^ int64(r)>>63)
+}
+
+// riceCoding chooses the partition order and Rice parameters for the
+// residual of an order-predictor over a block of n samples. The first
+// partition is shorter than the rest by the predictor's warm-up samples.
+func (e *Encoder) riceCoding(residual []int32, n, order int) riceCoding {
+	maxOrder := e.level.maxPartitionOrder
+	for maxOrder > 0 && (n%(1<<maxOrder) != 0 || n>>maxOrder <= order) {
+		maxOrder--
+	}
+
+	// Sum each partition at the finest order, then merge neighbours for
+	// each coarser order
+	finest := n >> maxOrder
+	sums := make([]uint64, 1<<maxOrder)
+	for i, r := range residual {
+		sums[(i+order)/finest] += zigzag(r)
+	}
+
+	var best riceCoding
+	for p := maxOrder; p >= 0; p-- {
+		partitions := 1 << p
+		size := n >> p
+		coding := riceCoding{partitionOrder: p, params: make([]int, partitions)}
+		for i, sum := range sums[:partitions] {
+			count := size
+			if i == 0 {
+				count -= order
+			}
+			k, bits := riceParam(sum, count)
+			coding.params[i] = k
+			coding.bits += bits
+			if k > maxRiceParam {
+				coding.rice2 = true
+			}
+		}
+		paramBits := 4
+		if coding.rice2 {
+			paramBits = 5
+		}
+		coding.bits += 2 + 4 + partitions*paramBits
+		if p == maxOrder || coding.bits < best.bits {
+			best = coding
+		}
+
+		for i := 0; i < partitions/2; i++ {
+			sums[i] = sums[2*i] + sums[2*i+1]
+		}
+	}
+	return best
+}
+
+// riceParam estimates the best Rice parameter for count residuals whose
+// zigzag values add up to sum, and the bits they take with it
+func riceParam(sum uint64, count int) (int, int) {
+	if count == 0 {
+		return 0, 0
+	}
+	cost := func(k int) int {
+		return count*(k+1) + int(sum>>uint(k))
+	}
+
+	// The mean residual is about 2^k for the best k
+	k := 0
+	if mean := sum / uint64(count); mean > 0 {
+		k = bits.Len64(mean) - 1
+	}
+	if k > maxRice2Param {
+		k = maxRice2Param
+	}
+	best, bestBits := k, cost(k)
+	for _, c := range []int{k - 1, k + 1} {
+		if c >= 0 && c <= maxRice2Param {
+			if b := cost(c); b < bestBits {
+				best, bestBits = c, b
+			}
+		}
+	}
+	return best, bestBits
+}
+
+// write writes the subframe
+func (sf *subframe) write(w *bitWriter) {
+	w.writeBits(0, 1)
+	switch sf.kind {
+	case subframeConstant:
+		w.writeBits(0, 6)
+	case subframeVerbatim:
+		w.writeBits(1, 6)
+	case subframeFixed:
+		w.writeBits(uint64(8|sf.order), 6)
+	case subframeLPC:
+		w.writeBits(uint64(32|(sf.order-1)), 6)
+	}
+	if sf.wasted > 0 {
+		w.writeBits(1, 1)
+		w.writeUnary(uint64(sf.wasted - 1))
+	} else {
+		w.writeBits(0, 1)
+	}
+
+	bps := uint(sf.bps)
+	switch sf.kind {
+	case subframeConstant:
+		w.writeSigned(int64(sf.samples[0]), bps)
+	case subframeVerbatim:
+		for _, s := range sf.samples {
+			w.writeSigned(int64(s), bps)
+		}
+	case subframeFixed:
+		for _, s := range sf.samples[:sf.order] {
+			w.writeSigned(int64(s), bps)
+		}
+		sf.writeResidual(w)
+	case subframeLPC:
+		for _, s := range sf.samples[:sf.order] {
+			w.writeSigned(int64(s), bps)
+		}
+		w.writeBits(uint64(sf.precision-1), 4)
+		w.writeSigned(int64(sf.shift), 5)
+		for _, c := range sf.coefs {
+			w.writeSigned(int64(c), uint(sf.precision))
+		}
+		sf.writeResidual(w)
+	}
+}
+
+// writeResidual writes the residual with its partitioned Rice coding
+func (sf *subframe) writeResidual(w *bitWriter) {
+	rice := sf.rice
+	paramBits := uint(4)
+	if rice.rice2 {
+		w.writeBits(1, 2)
+		paramBits = 5
+	} else {
+		w.writeBits(0, 2)
+	}
+	w.writeBits(uint64(rice.partitionOrder), 4)
+
+	n := len(sf.residual) + sf.order
+	size := n >> rice.partitionOrder
+	residual := sf.residual
+	for i, k := range rice.params {
+		count := size
+		if i == 0 {
+			count -= sf.order
+		}
+		w.writeBits(uint64(k), paramBits)
+		for _, r := range residual[:count] {
+			w.writeRice(zigzag(r), uint(k))
+		}
+		residual = residual[count:]
+	}
+}
@@ -0,0 +1,242 @@
+package flac
+
+import (
+	"math"
+)
+
+// maxShift is the largest right shift of an LPC prediction the subframe
+// header can hold
+const maxShift = 15
+
+// lpcSubframe codes x with a linear predictor fitted to the block, or
+// returns nil if no predictor can be fitted
+func (e *Encoder) lpcSubframe(x []int32, bps int) *subframe {
+	n := len(x)
+	maxOrder := e.level.maxLPCOrder
+	if maxOrder > n-1 {
+		maxOrder = n - 1
+	}
+	if maxOrder < 1 {
+		return nil
+	}
+
+	autoc := autocorrelation(x, e.window(n), maxOrder)
+	if autoc[0] == 0 {
+		return nil
+	}
+	coefs, errs := levinson(autoc)
+	if len(coefs) == 0 {
+		return nil
+	}
+	precision := coefPrecision(n)
+
+	orders := make([]int, 0, len(coefs))
+	if e.level.exhaustive {
+		for order := 1; order <= len(coefs); order++ {
+			orders = append(orders, order)
+		}
+	} else {
+		orders = append(orders, estimateOrder(errs, n, bps, precision))
+	}
+
+	var best *subframe
+	for _, order := range orders {
+		q, shift, ok := quantize(coefs[order-1], precision)
+		if !ok {
+			continue
+		}
+		residual, ok := lpcResidual(x, q, shift)
+		if !ok {
+			continue
+		}
+		rice := e.riceCoding(residual, n, order)
+		sf := &subframe{
+			kind:      subframeLPC,
+			bps:       bps,
+			samples:   x,
+			order:     order,
+			coefs:     q,
+			precision: precision,
+			shift:     shift,
+			residual:  residual,
+			rice:      rice,
+			bits:      order*bps + 4 + 5 + order*precision + rice.bits,
+		}
+		if best == nil || sf.bits < best.bits {
+			best = sf
+		}
+	}
+	return best
+}
+
+// window returns a Tukey window of length n that tapers over a quarter of
+// the block at each end, so the block edges do not distort the fit
+func (e *Encoder) window(n int) []float64 {
+	if w, ok := e.windows[n]; ok {
+		return w
+	}
+
+	w := make([]float64, n)
+	taper := n / 4
+	for i := range w {
+		w[i] = 1
+	}
+	for i := 0; i < taper; i++ {
+		v := 0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(taper))
+		w[i] = v
+		w[n-1-i] = v
+	}
+	e.windows[n] = w
+	return w
+}
+
+// autocorrelation returns the autocorrelation of the windowed signal for
+// lags 0 to maxLag
+func autocorrelation(x []int32, window []float64, maxLag int) []float64 {
+	data := make([]float64, len(x))
+	for i, s := range x {
+		data[i] = float64(s) * window[i]
+	}
+
+	autoc := make([]float64, maxLag+1)
+	for lag := range autoc {
+		var sum float64
+		for i := lag; i < len(data); i++ {
+			sum += data[i] * data[i-lag]
+		}
+		autoc[lag] = sum
+	}
+	return autoc
+}
+
+// levinson solves for the predictor coefficients of every order up to
+// len(autoc)-1 with the Levinson-Durbin recursion. coefs[m-1] predicts a
+// sample as the weighted sum of the m before it, most recent first, and
+// errs[m-1] is its prediction error. It stops early if the error vanishes.
+func levinson(autoc []float64) (coefs [][]float64, errs []float64) {
+	err := autoc[0]
+	var prev []float64
+	for m := 1; m < len(autoc); m++ {
+		k := autoc[m]
+		for j := 0; j < m-1; j++ {
+			k -= prev[j] * autoc[m-1-j]
+		}
+		k /= err
+
+		a := make([]float64, m)
+		for j := 0; j < m-1; j++ {
+			a[j] = prev[j] - k*prev[m-2-j]
+		}
+		a[m-1] = k
+
+		err *= 1 - k*k
+		if err <= 0 || math.IsNaN(err) {
+			break
+		}
+		coefs = append(coefs, a)
+		errs = append(errs, err)
+		prev = a
+	}
+	return coefs, errs
+}
+
+// coefPrecision returns the bits per quantized coefficient for a block of
+// n samples, following the reference encoder: longer blocks can afford
+// finer coefficients
+func coefPrecision(n int) int {
+	switch {
+	case n <= 192:
+		return 7
+	case n <= 384:
+		return 8
+	case n <= 576:
+		return 9
+	case n <= 1152:
+		return 10
+	case n <= 2304:
+		return 11
+	case n <= 4608:
+		return 12
+	}
+	return 13
+}
+
+// estimateOrder picks the predictor order expected to code the block in
+// the fewest bits, from the prediction error of each order
+func estimateOrder(errs []float64, n, bps, precision int) int {
+	best, bestBits := 1, math.Inf(1)
+	for i, err := range errs {
+		order := i + 1
+		perSample := 0.0
+		if err > 0 {
+			perSample = math.Max(0, 0.5*math.Log2(0.5*err/float64(n)))
+		}
+		bits := perSample*float64(n-order) + float64(order*(bps+precision))
+		if bits < bestBits {
+			best, bestBits = order, bits
+		}
+	}
+	return best
+}
+
+// quantize converts coefficients to integers of precision bits and the
+// right shift that scales their prediction back. It carries each rounding
+// error into the next coefficient. It reports false if the coefficients
+// are too large to represent.
+func quantize(coefs []float64, precision int) ([]int32, int, bool) {
+	var cmax float64
+	for _, c := range coefs {
+		cmax = math.Max(cmax, math.Abs(c))
+	}
+	if cmax == 0 {
+		return nil, 0, false
+	}
+
+	// cmax < 2^exp, and the largest coefficient must fit in precision-1
+	// bits plus sign
+	_, exp := math.Frexp(cmax)
+	shift := precision - 1 - exp
+	if shift > maxShift {
+		shift = maxShift
+	}
+	if shift < 0 {
+		return nil, 0, false
+	}
+
+	qmax := int32(1)<<(precision-1) - 1
+	qmin := -qmax - 1
+	q := make([]int32, len(coefs))
+	var carry float64
+	for i, c := range coefs {
+		carry += c * float64(int(1)<<shift)
+		v := int32(math.Round(carry))
+		if v > qmax {
+			v = qmax
+		} else if v < qmin {
+			v = qmin
+		}
+		carry -= float64(v)
+		q[i] = v
+	}
+	return q, shift, true
+}
+
+// lpcResidual returns the residual of x after prediction with the
+// quantized coefficients q. It reports false if a residual does not fit
+// in 32 bits, which the format requires.
+func lpcResidual(x []int32, q []int32, shift int) ([]int32, bool) {
+	order := len(q)
+	residual := make([]int32, len(x)-order)
+	for i := order; i < len(x); i++ {
+		var sum int64
+		for j, c := range q {
+			sum += int64(c) * int64(x[i-1-j])
+		}
+		r := int64(x[i]) - sum>>uint(shift)
+		if r < math.MinInt32 || r > math.MaxInt32 {
+			return nil, false
+		}
+		residual[i-order] = int32(r)
+	}
+	return residual, true
+}
@@ -0,0 +1,131 @@
+package flac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Metadata block types
+const (
+	blockStreamInfo    = 0
+	blockPadding       = 1
+	blockVorbisComment = 4
+	blockPicture       = 6
+)
+
+// streamInfoSize is the length of the STREAMINFO block body
+const streamInfoSize = 34
+
+// maxBlockLength is the largest metadata block body: 24 bits of length
+const maxBlockLength = 1<<24 - 1
+
+// paddingSize leaves room to edit tags later without rewriting the file,
+// as the reference encoder does
+const paddingSize = 8192
+
+// PictureFrontCover is the PICTURE type for the front cover
+const PictureFrontCover = 3
+
+// Comment is a Vorbis comment field. Names are case-insensitive ASCII,
+// conventionally upper case; a name may appear more than once.
+type Comment struct {
+	Name  string
+	Value string
+}
+
+// Picture is an image stored in a PICTURE block
+type Picture struct {
+	Type   int    // PictureFrontCover, etc.
+	MIME   string // e.g. "image/jpeg"
+	Width  int
+	Height int
+	Depth  int // bits per pixel
+	Data   []byte
+}
+
+// streamInfo holds the STREAMINFO fields that are only known once the
+// whole stream has been encoded
+type streamInfo struct {
+	minFrameSize int
+	maxFrameSize int
+	totalSamples int64
+	md5          [16]byte
+}
+
+// writeBlockHeader writes a metadata block header
+func writeBlockHeader(w io.Writer, blockType, length int, last bool) error {
+	if length > maxBlockLength {
+		return fmt.Errorf("metadata block too large: %d bytes", length)
+	}
+	head := []byte{byte(blockType), byte(length >> 16), byte(length >> 8), byte(length)}
+	if last {
+		head[0] |= 0x80
+	}
+	_, err := w.Write(head)
+	return err
+}
+
+// marshalStreamInfo encodes the STREAMINFO block body
+func marshalStreamInfo(format Format, blockSize int, info streamInfo) []byte {
+	b := make([]byte, streamInfoSize)
+	binary.BigEndian.PutUint16(b[0:], uint16(blockSize))
+	binary.BigEndian.PutUint16(b[2:], uint16(blockSize))
+	b[4], b[5], b[6] = byte(info.minFrameSize>>16), byte(info.minFrameSize>>8), byte(info.minFrameSize)
+	b[7], b[8], b[9] = byte(info.maxFrameSize>>16), byte(info.maxFrameSize>>8), byte(info.maxFrameSize)
+
+	// Sample rate (20 bits), channels-1 (3), bits-1 (5), total samples (36)
+	packed := uint64(format.SampleRate)<<44 |
+		uint64(format.Channels-1)<<41 |
+		uint64(format.BitDepth-1)<<36 |
+		uint64(info.totalSamples)&(1<<36-1)
+	binary.BigEndian.PutUint64(b[10:], packed)
+
+	copy(b[18:], info.md5[:])
+	return b
+}
+
+// marshalVorbisComment encodes a VORBIS_COMMENT block body. Unlike the
+// rest of FLAC, its lengths are little-endian.
+func marshalVorbisComment(vendor string, comments []Comment) []byte {
+	var b []byte
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vendor)))
+	b = append(b, vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, c := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c.Name)+1+len(c.Value)))
+		b = append(b, c.Name...)
+		b = append(b, '=')
+		b = append(b, c.Value...)
+	}
+	return b
+}
+
+// marshalPicture encodes a PICTURE block body
+func marshalPicture(p *Picture) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, uint32(p.Type))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.MIME)))
+	b = append(b, p.MIME...)
+	b = binary.BigEndian.AppendUint32(b, 0) // empty description
+	b = binary.BigEndian.AppendUint32(b, uint32(p.Width))
+	b = binary.BigEndian.AppendUint32(b, uint32(p.Height))
+	b = binary.BigEndian.AppendUint32(b, uint32(p.Depth))
+	b = binary.BigEndian.AppendUint32(b, 0) // not an indexed-color image
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Data)))
+	return append(b, p.Data...)
+}
+
+// validComment reports whether name is a valid Vorbis comment field name:
+// printable ASCII other than '='
+func validComment(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] > 0x7D || name[i] == '=' {
+			return false
+		}
+	}
+	return true
+}
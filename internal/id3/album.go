@@ -0,0 +1,102 @@
+package id3
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// Album is a bundle's manifest and cover art, from which the tag of each
+// of its tracks is built
+type Album struct {
+	Manifest *manifest.Manifest
+	Cover    []byte // nil if the bundle has no cover image
+}
+
+// LoadAlbum reads manifest.yaml and the cover image of the bundle source
+// directory dir
+func LoadAlbum(dir string) (*Album, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m manifest.Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	cover := m.Images.Cover.Filename
+	if cover == "" {
+		cover = "cover.jpg"
+	}
+	coverData, err := os.ReadFile(filepath.Join(dir, "images", filepath.FromSlash(cover)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cover image: %w", err)
+	}
+
+	return &Album{Manifest: &m, Cover: coverData}, nil
+}
+
+// FindAlbumDir returns the bundle source directory an audio file belongs
+// to: the directory holding manifest.yaml, either the file's own directory
+// or, for files in audio/, its parent. It returns "" if there is none.
+func FindAlbumDir(audioPath string) string {
+	dir := filepath.Dir(audioPath)
+	for _, candidate := range []string{dir, filepath.Dir(dir)} {
+		if _, err := os.Stat(filepath.Join(candidate, "manifest.yaml")); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// TrackTag returns the tag for the audio file name, taken from the track
+// whose filename is name without its extension. It reports false if no
+// track matches.
+func (a *Album) TrackTag(name string) (*Tag, bool) {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+
+	var track *manifest.Track
+	for i := range a.Manifest.Tracks {
+		if a.Manifest.Tracks[i].Filename == base {
+			track = &a.Manifest.Tracks[i]
+			break
+		}
+	}
+	if track == nil {
+		return nil, false
+	}
+
+	release := a.Manifest.Release
+	tag := &Tag{
+		Title:         track.Title,
+		Artist:        release.Artist,
+		AlbumArtist:   release.Artist,
+		Album:         release.Title,
+		Track:         track.Number,
+		TrackTotal:    len(a.Manifest.Tracks),
+		Date:          release.ReleaseDate,
+		Genre:         release.Genre,
+		Composers:     track.Composers,
+		CatalogNumber: release.CatalogNumber,
+		Cover:         a.Cover,
+	}
+
+	rights := a.Manifest.Rights
+	switch {
+	case rights.CopyrightYear > 0 && rights.CopyrightHolder != "":
+		tag.Copyright = strconv.Itoa(rights.CopyrightYear) + " " + rights.CopyrightHolder
+	case rights.CopyrightYear > 0:
+		tag.Copyright = strconv.Itoa(rights.CopyrightYear)
+	}
+
+	return tag, true
+}
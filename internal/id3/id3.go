@@ -0,0 +1,192 @@
+// Package id3 writes ID3v2.4 tags to MP3 files.
+package id3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Text encodings defined by ID3v2.4; rice writes UTF-8 only
+const encodingUTF8 = 3
+
+// pictureFrontCover is the APIC picture type for the front cover
+const pictureFrontCover = 3
+
+// maxTagSize is the largest size an ID3v2 header can record: 28 bits
+const maxTagSize = 1<<28 - 1
+
+// Tag holds the fields rice writes. Empty fields are left out.
+type Tag struct {
+	Title         string
+	Artist        string
+	AlbumArtist   string
+	Album         string
+	Track         int
+	TrackTotal    int
+	Date          string // YYYY, YYYY-MM or YYYY-MM-DD
+	Genre         string
+	Composers     []string
+	Copyright     string // "YYYY holder", as ID3 requires
+	CatalogNumber string
+	Cover         []byte // JPEG front cover
+}
+
+// Marshal encodes the tag as an ID3v2.4 tag
+func (t *Tag) Marshal() ([]byte, error) {
+	var frames bytes.Buffer
+	writeText := func(id string, values ...string) {
+		var present []string
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				present = append(present, v)
+			}
+		}
+		if len(present) > 0 {
+			// ID3v2.4 separates multiple values with a null character
+			writeFrame(&frames, id, append([]byte{encodingUTF8}, strings.Join(present, "\x00")...))
+		}
+	}
+
+	writeText("TIT2", t.Title)
+	writeText("TPE1", t.Artist)
+	writeText("TPE2", t.AlbumArtist)
+	writeText("TALB", t.Album)
+	if t.Track > 0 {
+		track := strconv.Itoa(t.Track)
+		if t.TrackTotal > 0 {
+			track += "/" + strconv.Itoa(t.TrackTotal)
+		}
+		writeText("TRCK", track)
+	}
+	writeText("TDRC", t.Date)
+	writeText("TCON", t.Genre)
+	writeText("TCOM", t.Composers...)
+	writeText("TCOP", t.Copyright)
+
+	// ID3 has no catalog number frame; TXXX:CATALOGNUMBER is the common
+	// convention among taggers
+	if catalog := strings.TrimSpace(t.CatalogNumber); catalog != "" {
+		var body bytes.Buffer
+		body.WriteByte(encodingUTF8)
+		body.WriteString("CATALOGNUMBER\x00")
+		body.WriteString(catalog)
+		writeFrame(&frames, "TXXX", body.Bytes())
+	}
+
+	if len(t.Cover) > 0 {
+		var body bytes.Buffer
+		body.WriteByte(encodingUTF8)
+		body.WriteString("image/jpeg\x00")
+		body.WriteByte(pictureFrontCover)
+		body.WriteByte(0) // empty description
+		body.Write(t.Cover)
+		writeFrame(&frames, "APIC", body.Bytes())
+	}
+
+	if frames.Len() > maxTagSize {
+		return nil, fmt.Errorf("ID3 tag too large: %d bytes", frames.Len())
+	}
+
+	var tag bytes.Buffer
+	tag.WriteString("ID3")
+	tag.Write([]byte{4, 0, 0}) // version 2.4.0, no flags
+	tag.Write(synchsafe(frames.Len()))
+	tag.Write(frames.Bytes())
+	return tag.Bytes(), nil
+}
+
+// writeFrame appends a frame with a synchsafe size and no flags
+func writeFrame(w *bytes.Buffer, id string, body []byte) {
+	w.WriteString(id)
+	w.Write(synchsafe(len(body)))
+	w.Write([]byte{0, 0})
+	w.Write(body)
+}
+
+// synchsafe encodes n in four bytes of seven bits each
+func synchsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// TagSize returns the length of the ID3v2 tag at the start of r, including
+// its header and footer, or 0 if there is none
+func TagSize(r io.Reader) (int64, error) {
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if string(head[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	size := int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 | int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F)
+	size += 10
+	if head[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return size, nil
+}
+
+// WriteFile writes tag to the MP3 file at path, replacing any ID3v2 tag it
+// has. The file is rewritten through a temporary file and renamed into
+// place, so it is never left half-written.
+func WriteFile(path string, tag *Tag) error {
+	encoded, err := tag.Marshal()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	oldSize, err := TagSize(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if oldSize > info.Size() {
+		return fmt.Errorf("%s: ID3 tag is longer than the file", path)
+	}
+	if _, err := in.Seek(oldSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := out.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := out.Write(encoded); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write tag: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy audio: %w", err)
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	in.Close()
+	return os.Rename(tmpPath, path)
+}
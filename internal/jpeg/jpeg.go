@@ -0,0 +1,99 @@
+// Package jpeg reads JPEG frame headers without decoding image data.
+package jpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Info holds the frame header fields of a JPEG image
+type Info struct {
+	Width       int
+	Height      int
+	Components  int
+	Progressive bool
+}
+
+// Grayscale reports whether the image has a single component
+func (j *Info) Grayscale() bool {
+	return j.Components == 1
+}
+
+// CMYK reports whether the image uses four components (CMYK or YCCK)
+func (j *Info) CMYK() bool {
+	return j.Components == 4
+}
+
+// ReadInfo walks the JPEG marker segments up to the first SOF marker
+func ReadInfo(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, fmt.Errorf("missing JPEG start of image marker")
+	}
+
+	for {
+		// Find the next marker, skipping any fill bytes
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("no frame header found in JPEG")
+		}
+		if b != 0xFF {
+			return nil, fmt.Errorf("corrupt JPEG: expected marker, found 0x%02X", b)
+		}
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = br.ReadByte()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("no frame header found in JPEG")
+		}
+
+		// Markers without a length field
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			return nil, fmt.Errorf("no frame header found in JPEG")
+		}
+
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(br, lenBuf[:]); err != nil {
+			return nil, fmt.Errorf("truncated JPEG segment")
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if length < 0 {
+			return nil, fmt.Errorf("corrupt JPEG segment length")
+		}
+
+		if isSOFMarker(marker) {
+			if length < 6 {
+				return nil, fmt.Errorf("truncated JPEG frame header")
+			}
+			frame := make([]byte, 6)
+			if _, err := io.ReadFull(br, frame); err != nil {
+				return nil, fmt.Errorf("truncated JPEG frame header")
+			}
+			return &Info{
+				Height:      int(binary.BigEndian.Uint16(frame[1:3])),
+				Width:       int(binary.BigEndian.Uint16(frame[3:5])),
+				Components:  int(frame[5]),
+				Progressive: marker == 0xC2 || marker == 0xC6 || marker == 0xCA || marker == 0xCE,
+			}, nil
+		}
+
+		if _, err := br.Discard(length); err != nil {
+			return nil, fmt.Errorf("truncated JPEG segment")
+		}
+	}
+}
+
+// isSOFMarker reports whether marker starts a frame (SOF0-SOF15, excluding
+// DHT, JPG and DAC which share the range)
+func isSOFMarker(marker byte) bool {
+	return marker >= 0xC0 && marker <= 0xCF &&
+		marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+}
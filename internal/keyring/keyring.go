@@ -0,0 +1,389 @@
+// Package keyring stores named signing keys and trusted public keys.
+//
+// A keyring is a directory holding keyring.yaml, which lists every key with
+// its public half, and a private/ directory with the private keys this
+// machine can sign with. Keys are identified by name, by key ID or by
+// fingerprint, all derived from the public key.
+package keyring
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davesmith10/rice-cli/internal/sign"
+	"gopkg.in/yaml.v3"
+)
+
+// indexFile lists the keys in a keyring directory
+const indexFile = "keyring.yaml"
+
+// ErrNotFound is returned when no key matches a name, ID or fingerprint
+var ErrNotFound = errors.New("key not found")
+
+// UsageTimestamp marks the key of a timestamp authority. Such keys are
+// trusted for timestamps only, never as bundle signers.
+const UsageTimestamp = "timestamp"
+
+// validName restricts key names to characters safe in file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Key is a key in the keyring
+type Key struct {
+	Name         string     `yaml:"name"`
+	ID           string     `yaml:"id"`
+	Fingerprint  string     `yaml:"fingerprint"`
+	Public       string     `yaml:"public_key"`
+	Secret       bool       `yaml:"secret"`
+	Trusted      bool       `yaml:"trusted"`
+	Usage        string     `yaml:"usage,omitempty"`
+	AddedAt      time.Time  `yaml:"added_at"`
+	NotBefore    *time.Time `yaml:"not_before,omitempty"`
+	NotAfter     *time.Time `yaml:"not_after,omitempty"`
+	RevokedAt    *time.Time `yaml:"revoked_at,omitempty"`
+	RevokeReason string     `yaml:"revoke_reason,omitempty"`
+
+	publicKey ed25519.PublicKey
+}
+
+// PublicKey returns the public half of the key
+func (k *Key) PublicKey() ed25519.PublicKey {
+	return k.publicKey
+}
+
+// Revoked reports whether the key has been revoked
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// ValidAt reports whether the key may sign at t: within its validity
+// period and before any revocation
+func (k *Key) ValidAt(t time.Time) bool {
+	if k.NotBefore != nil && t.Before(*k.NotBefore) {
+		return false
+	}
+	if k.NotAfter != nil && t.After(*k.NotAfter) {
+		return false
+	}
+	return k.RevokedAt == nil || t.Before(*k.RevokedAt)
+}
+
+// Policy returns the period in which signatures by the key are accepted
+func (k *Key) Policy() sign.KeyPolicy {
+	var policy sign.KeyPolicy
+	if k.NotBefore != nil {
+		policy.NotBefore = *k.NotBefore
+	}
+	if k.NotAfter != nil {
+		policy.NotAfter = *k.NotAfter
+	}
+	if k.RevokedAt != nil {
+		policy.RevokedAt = *k.RevokedAt
+	}
+	return policy
+}
+
+// Keyring is a directory of named keys
+type Keyring struct {
+	dir  string
+	keys []*Key
+}
+
+// DefaultDir returns $RICE_KEYRING, or ~/.rice/keyring
+func DefaultDir() string {
+	if dir := os.Getenv("RICE_KEYRING"); dir != "" {
+		return dir
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".rice", "keyring")
+}
+
+// Open loads the keyring in dir. A missing keyring is empty.
+func Open(dir string) (*Keyring, error) {
+	kr := &Keyring{dir: dir}
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return kr, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var index struct {
+		Keys []*Key `yaml:"keys"`
+	}
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+
+	for _, key := range index.Keys {
+		decoded, err := base64.StdEncoding.DecodeString(key.Public)
+		if err != nil || len(decoded) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("keyring entry %s has an invalid public key", key.Name)
+		}
+		key.publicKey = ed25519.PublicKey(decoded)
+	}
+	kr.keys = index.Keys
+
+	return kr, nil
+}
+
+// Dir returns the keyring directory
+func (kr *Keyring) Dir() string {
+	return kr.dir
+}
+
+// Keys returns every key, sorted by name
+func (kr *Keyring) Keys() []*Key {
+	keys := append([]*Key(nil), kr.keys...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// Find returns the key with the given name, key ID or fingerprint
+func (kr *Keyring) Find(ref string) (*Key, error) {
+	for _, key := range kr.keys {
+		if key.Name == ref || key.ID == ref || key.Fingerprint == ref {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+}
+
+// Lookup returns the key with the given public key fingerprint, if any
+func (kr *Keyring) Lookup(fingerprint string) *Key {
+	for _, key := range kr.keys {
+		if key.Fingerprint == fingerprint {
+			return key
+		}
+	}
+	return nil
+}
+
+// Trust returns what verification accepts: every trusted signing key,
+// limited to its validity period and to signatures made before any
+// revocation, and the trusted timestamp authorities
+func (kr *Keyring) Trust() *sign.Trust {
+	trust := &sign.Trust{Policies: make(map[string]sign.KeyPolicy)}
+	for _, key := range kr.keys {
+		if !key.Trusted {
+			continue
+		}
+		if key.Usage == UsageTimestamp {
+			if !key.Revoked() {
+				trust.Timestampers = append(trust.Timestampers, key.publicKey)
+			}
+			continue
+		}
+		trust.Keys = append(trust.Keys, key.publicKey)
+		if policy := key.Policy(); policy != (sign.KeyPolicy{}) {
+			trust.Policies[key.Fingerprint] = policy
+		}
+	}
+	return trust
+}
+
+// Generate creates a new key pair named name, storing the private key in
+// format. The private key is encrypted if passphrase is not empty.
+func (kr *Keyring) Generate(name, format string, passphrase []byte) (*Key, error) {
+	_, privateKey, err := sign.GenerateKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	data, err := sign.MarshalPrivateKey(privateKey, format, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return kr.AddPrivate(name, data, func() ([]byte, error) { return passphrase, nil })
+}
+
+// AddPrivate stores a private key file under name. The file is kept as
+// is, so encrypted keys stay encrypted. passphrase is only asked for keys
+// whose public half cannot be read without it. Keys this machine signs
+// with are trusted for verification too.
+func (kr *Keyring) AddPrivate(name string, data []byte, passphrase sign.PassphraseFunc) (*Key, error) {
+	publicKey, err := sign.KeyFilePublicKey(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := kr.newKey(name, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.Secret = true
+
+	if err := kr.SetPrivate(key, data, passphrase); err != nil {
+		return nil, err
+	}
+
+	kr.keys = append(kr.keys, key)
+	return key, kr.save()
+}
+
+// SetPrivate replaces the private key file of key, for example to change
+// its passphrase. data must hold the same key; passphrase is as for
+// AddPrivate.
+func (kr *Keyring) SetPrivate(key *Key, data []byte, passphrase sign.PassphraseFunc) error {
+	publicKey, err := sign.KeyFilePublicKey(data, passphrase)
+	if err != nil {
+		return err
+	}
+	if !publicKey.Equal(key.publicKey) {
+		return fmt.Errorf("private key does not match %s", key.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Join(kr.dir, "private"), 0700); err != nil {
+		return fmt.Errorf("failed to create keyring: %w", err)
+	}
+	if err := writeFileAtomic(kr.privatePath(key), data); err != nil {
+		return fmt.Errorf("failed to save private key: %w", err)
+	}
+	return nil
+}
+
+// AddPublic stores a trusted public key under name. usage is empty for
+// signing keys, or UsageTimestamp for a timestamp authority.
+func (kr *Keyring) AddPublic(name string, publicKey ed25519.PublicKey, usage string) (*Key, error) {
+	if usage != "" && usage != UsageTimestamp {
+		return nil, fmt.Errorf("unknown key usage %q", usage)
+	}
+	key, err := kr.newKey(name, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.Usage = usage
+
+	kr.keys = append(kr.keys, key)
+	return key, kr.save()
+}
+
+func (kr *Keyring) newKey(name string, publicKey ed25519.PublicKey) (*Key, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid key name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	if _, err := kr.Find(name); err == nil {
+		return nil, fmt.Errorf("a key named %s already exists", name)
+	}
+	fingerprint := sign.Fingerprint(publicKey)
+	if existing := kr.Lookup(fingerprint); existing != nil {
+		return nil, fmt.Errorf("this key is already in the keyring as %s", existing.Name)
+	}
+
+	return &Key{
+		Name:        name,
+		ID:          sign.KeyID(publicKey),
+		Fingerprint: fingerprint,
+		Public:      base64.StdEncoding.EncodeToString(publicKey),
+		Trusted:     true,
+		AddedAt:     time.Now().UTC().Truncate(time.Second),
+		publicKey:   publicKey,
+	}, nil
+}
+
+// PrivateKeyPath returns the private key file of key
+func (kr *Keyring) PrivateKeyPath(key *Key) (string, error) {
+	if !key.Secret {
+		return "", fmt.Errorf("no private key is stored for %s", key.Name)
+	}
+	return kr.privatePath(key), nil
+}
+
+// Encrypted reports whether the private key of key is passphrase-protected
+func (kr *Keyring) Encrypted(key *Key) bool {
+	if !key.Secret {
+		return false
+	}
+	data, err := os.ReadFile(kr.privatePath(key))
+	return err == nil && sign.IsEncryptedKey(data)
+}
+
+func (kr *Keyring) privatePath(key *Key) string {
+	return filepath.Join(kr.dir, "private", key.Name+".key")
+}
+
+// Revoke marks a key as revoked from effective on. Signatures the key
+// made before then stay valid; backdate effective to when a key was
+// compromised to reject everything signed since.
+func (kr *Keyring) Revoke(ref, reason string, effective time.Time) (*Key, error) {
+	key, err := kr.Find(ref)
+	if err != nil {
+		return nil, err
+	}
+	effective = effective.UTC().Truncate(time.Second)
+
+	// A revocation can be moved earlier, e.g. once a compromise turns out
+	// to predate it, but never later
+	if key.Revoked() && !effective.Before(*key.RevokedAt) {
+		return nil, fmt.Errorf("key %s was already revoked on %s", key.Name, key.RevokedAt.Format(time.RFC3339))
+	}
+
+	key.RevokedAt = &effective
+	if reason = strings.TrimSpace(reason); reason != "" || key.RevokeReason == "" {
+		key.RevokeReason = reason
+	}
+	return key, kr.save()
+}
+
+// SetValidity sets the period in which a key may sign. Nil bounds leave
+// that side of the period open.
+func (kr *Keyring) SetValidity(ref string, notBefore, notAfter *time.Time) (*Key, error) {
+	key, err := kr.Find(ref)
+	if err != nil {
+		return nil, err
+	}
+	if notBefore != nil && notAfter != nil && !notBefore.Before(*notAfter) {
+		return nil, fmt.Errorf("validity period ends before it starts")
+	}
+
+	key.NotBefore, key.NotAfter = utcTime(notBefore), utcTime(notAfter)
+	return key, kr.save()
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC().Truncate(time.Second)
+	return &utc
+}
+
+// save writes keyring.yaml
+func (kr *Keyring) save() error {
+	if err := os.MkdirAll(kr.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create keyring: %w", err)
+	}
+
+	data, err := yaml.Marshal(struct {
+		Keys []*Key `yaml:"keys"`
+	}{kr.Keys()})
+	if err != nil {
+		return fmt.Errorf("failed to encode keyring: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(kr.dir, indexFile), data); err != nil {
+		return fmt.Errorf("failed to save keyring: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data, readable only by the owner
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return nil
+}
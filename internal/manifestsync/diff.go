@@ -0,0 +1,187 @@
+package manifestsync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type lineOp struct {
+	kind opKind
+	line string
+}
+
+// diffLines computes a minimal line edit script from a to b
+func diffLines(a, b []string) []lineOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []lineOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, lineOp{opEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, lineOp{opDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, lineOp{opInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, lineOp{opDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, lineOp{opInsert, b[j]})
+	}
+	return ops
+}
+
+// restoreBlankLines re-inserts blank lines from original that re-encoding
+// through yaml.v3 dropped, keeping every other line of updated. Within a
+// changed block the blank lines go after the new lines, so they keep
+// separating the sections that follow. Where the change moved them next
+// to a different line, they are dropped rather than placed between a
+// line and the more indented lines that belong to it, such as a key and
+// its sequence or a sequence item and its fields.
+func restoreBlankLines(original, updated string) string {
+	var out, blanks []string
+	// prev is the last line written, lastOriginal the last non-blank line
+	// of original seen and blanksAfter the original line the pending
+	// blanks followed
+	var prev, lastOriginal, blanksAfter string
+	for _, op := range diffLines(splitLines(original), splitLines(updated)) {
+		switch op.kind {
+		case opEqual:
+			if len(blanks) > 0 && (prev == blanksAfter || indentation(op.line) <= indentation(prev)) {
+				out = append(out, blanks...)
+			}
+			blanks = nil
+			out = append(out, op.line)
+			prev, lastOriginal = op.line, op.line
+		case opInsert:
+			out = append(out, op.line)
+			prev = op.line
+		case opDelete:
+			if strings.TrimSpace(op.line) != "" {
+				lastOriginal = op.line
+				continue
+			}
+			if len(blanks) == 0 {
+				blanksAfter = lastOriginal
+			}
+			blanks = append(blanks, op.line)
+		}
+	}
+	out = append(out, blanks...)
+	return strings.Join(out, "\n") + "\n"
+}
+
+// indentation returns the number of leading spaces of a line
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// Diff renders a unified diff between two versions of a file
+func Diff(name, original, updated string) string {
+	ops := diffLines(splitLines(original), splitLines(updated))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", name, name)
+
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk until a run of unchanged lines longer than twice the context
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext, len(ops))
+
+		// Line numbers of the hunk in each file
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != opInsert {
+				oldLine++
+			}
+			if op.kind != opDelete {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != opInsert {
+				oldCount++
+			}
+			if op.kind != opDelete {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, op := range ops[from:to] {
+			switch op.kind {
+			case opEqual:
+				b.WriteString(" " + op.line + "\n")
+			case opDelete:
+				b.WriteString("-" + op.line + "\n")
+			case opInsert:
+				b.WriteString("+" + op.line + "\n")
+			}
+		}
+
+		start = to
+	}
+
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
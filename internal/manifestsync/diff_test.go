@@ -0,0 +1,52 @@
+package manifestsync
+
+import "testing"
+
+func TestRestoreBlankLines(t *testing.T) {
+	tests := []struct {
+		name              string
+		original, updated string
+		want              string
+	}{
+		{
+			name:     "value changed",
+			original: "a: 1\n\nb: 2\n",
+			updated:  "a: 3\nb: 2\n",
+			want:     "a: 3\n\nb: 2\n",
+		},
+		{
+			name:     "unchanged blank after a key",
+			original: "tracks:\n\n  - number: 1\n",
+			updated:  "tracks:\n  - number: 1\n",
+			want:     "tracks:\n\n  - number: 1\n",
+		},
+		{
+			name: "sequence items merged",
+			original: "audio_formats:\n  - format: mp3\n    bitrate: 320\n\n" +
+				"  - format: flac\n    bit_depth: 16\n    sample_rate: 44100\n\n# Next\nx: 1\n",
+			updated: "audio_formats:\n  - format: wav\n    bit_depth: 16\n    sample_rate: 44100\n# Next\nx: 1\n",
+			want:    "audio_formats:\n  - format: wav\n    bit_depth: 16\n    sample_rate: 44100\n\n# Next\nx: 1\n",
+		},
+		{
+			name: "first sequence item removed",
+			original: "audio_formats:\n  - format: mp3\n    bitrate: 320\n\n" +
+				"  - format: flac\n    bit_depth: 16\n\n# Next\nx: 1\n",
+			updated: "audio_formats:\n  - format: flac\n    bit_depth: 16\n  - format: wav\n    bit_depth: 24\n# Next\nx: 1\n",
+			want:    "audio_formats:\n  - format: flac\n    bit_depth: 16\n  - format: wav\n    bit_depth: 24\n\n# Next\nx: 1\n",
+		},
+		{
+			name:     "sequence item added",
+			original: "formats:\n  - a\n\n# Next\nx: 1\n",
+			updated:  "formats:\n  - a\n  - b\n# Next\nx: 1\n",
+			want:     "formats:\n  - a\n  - b\n\n# Next\nx: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restoreBlankLines(tt.original, tt.updated); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
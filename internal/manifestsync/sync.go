@@ -0,0 +1,276 @@
+// Package manifestsync fills in manifest.yaml fields that can be derived
+// from the files in a bundle directory.
+package manifestsync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/audio"
+	"github.com/davesmith10/rice-cli/internal/jpeg"
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// formatOrder is the order new audio_formats entries are added in, which
+// is also the preference order when probing a track's duration
+var formatOrder = []string{"flac", "wav", "mp3", "ogg"}
+
+// Result describes the outcome of a sync
+type Result struct {
+	Original []byte
+	Updated  []byte
+	Changes  []string
+}
+
+// Changed reports whether the manifest needs rewriting
+func (r *Result) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+// Sync inspects a bundle directory and computes an updated manifest.yaml
+// with real track durations, image dimensions and audio formats. The file
+// itself is not modified.
+func Sync(dir string) (*Result, error) {
+	original, err := os.ReadFile(filepath.Join(dir, "manifest.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(original, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse manifest: document is not a mapping")
+	}
+
+	s := &syncer{
+		dir:    dir,
+		root:   doc.Content[0],
+		result: &Result{Original: original},
+	}
+	if err := s.scanAudio(); err != nil {
+		return nil, err
+	}
+
+	s.syncTracks()
+	s.syncImages()
+	s.syncFormats()
+
+	if !s.result.Changed() {
+		s.result.Updated = original
+		return s.result, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	enc.Close()
+
+	s.result.Updated = []byte(restoreBlankLines(string(original), buf.String()))
+	return s.result, nil
+}
+
+type syncer struct {
+	dir    string
+	root   *yaml.Node
+	result *Result
+
+	// files maps each audio format present to its sorted file names
+	files map[string][]string
+}
+
+func (s *syncer) change(format string, args ...interface{}) {
+	s.result.Changes = append(s.result.Changes, fmt.Sprintf(format, args...))
+}
+
+func (s *syncer) scanAudio() error {
+	s.files = make(map[string][]string)
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "audio"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read audio directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if format := audio.FormatFromExt(filepath.Ext(entry.Name())); format != "" {
+			s.files[format] = append(s.files[format], entry.Name())
+		}
+	}
+	return nil
+}
+
+func (s *syncer) syncTracks() {
+	tracks := mappingValue(s.root, "tracks")
+	if tracks == nil || tracks.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, node := range tracks.Content {
+		filename := mappingValue(node, "filename")
+		if filename == nil || filename.Value == "" {
+			continue
+		}
+
+		info := s.probeTrack(filename.Value)
+		if info == nil {
+			continue
+		}
+
+		duration := manifest.FormatDuration(info.Duration)
+		if old, changed := setString(node, "duration", duration); changed {
+			s.change("track %s duration: %q -> %q", trackLabel(node), old, duration)
+		}
+	}
+}
+
+// probeTrack probes the first readable audio file for a track, preferring
+// lossless formats
+func (s *syncer) probeTrack(filename string) *audio.Info {
+	for _, format := range formatOrder {
+		path := filepath.Join(s.dir, "audio", filename+"."+format)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if info, err := audio.ProbeFile(path); err == nil {
+			return info
+		}
+	}
+	return nil
+}
+
+func (s *syncer) syncImages() {
+	images := mappingValue(s.root, "images")
+	for _, key := range []string{"cover", "cover_large", "back", "artist"} {
+		node := mappingValue(images, key)
+		filename := mappingValue(node, "filename")
+		if filename == nil || filename.Value == "" {
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(s.dir, "images", filename.Value))
+		if err != nil {
+			continue
+		}
+		info, err := jpeg.ReadInfo(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+
+		if old, changed := setInt(node, "width", info.Width); changed {
+			s.change("images.%s.width: %s -> %d", key, orNone(old), info.Width)
+		}
+		if old, changed := setInt(node, "height", info.Height); changed {
+			s.change("images.%s.height: %s -> %d", key, orNone(old), info.Height)
+		}
+	}
+}
+
+func (s *syncer) syncFormats() {
+	formats := mappingValue(s.root, "audio_formats")
+	if formats == nil {
+		formats = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		s.root.Content = append(s.root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "audio_formats"}, formats)
+	}
+	if formats.Kind != yaml.SequenceNode {
+		return
+	}
+
+	// Keep entries for formats that are present, dropping the rest
+	listed := make(map[string]bool)
+	var kept []*yaml.Node
+	for _, node := range formats.Content {
+		format := strings.ToLower(scalarValue(mappingValue(node, "format")))
+		if len(s.files[format]) == 0 {
+			s.change("audio_formats: removed %s (no files present)", orNone(format))
+			continue
+		}
+		listed[format] = true
+		kept = append(kept, node)
+		s.syncFormat(node, format)
+	}
+
+	// Add formats found on disk but not listed
+	for _, format := range formatOrder {
+		if len(s.files[format]) == 0 || listed[format] {
+			continue
+		}
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setScalar(node, "format", format, "!!str", 0)
+		kept = append(kept, node)
+		s.change("audio_formats: added %s", format)
+		s.syncFormat(node, format)
+	}
+
+	formats.Content = kept
+}
+
+// syncFormat fills in the stream parameters of an audio_formats entry from
+// the first file of that format
+func (s *syncer) syncFormat(node *yaml.Node, format string) {
+	files := append([]string(nil), s.files[format]...)
+	sort.Strings(files)
+
+	info, err := audio.ProbeFile(filepath.Join(s.dir, "audio", files[0]))
+	if err != nil {
+		return
+	}
+
+	fields := map[string]int{}
+	switch format {
+	case "mp3":
+		if !info.VBR {
+			fields["bitrate"] = info.Bitrate
+		}
+	case "flac", "wav":
+		fields["bit_depth"] = info.BitDepth
+		fields["sample_rate"] = info.SampleRate
+	}
+
+	for _, key := range []string{"bitrate", "bit_depth", "sample_rate"} {
+		value, ok := fields[key]
+		if !ok || value == 0 {
+			continue
+		}
+		if old, changed := setInt(node, key, value); changed {
+			s.change("audio_formats %s.%s: %s -> %d", format, key, orNone(old), value)
+		}
+	}
+}
+
+func trackLabel(node *yaml.Node) string {
+	if number := scalarValue(mappingValue(node, "number")); number != "" {
+		return number
+	}
+	return scalarValue(mappingValue(node, "filename"))
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package manifestsync
+
+import (
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mappingValue returns the value node for key in a mapping node
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setString sets key to a double-quoted string, appending the key if it is
+// missing, and returns the previous value and whether anything changed
+func setString(m *yaml.Node, key, value string) (string, bool) {
+	return setScalar(m, key, value, "!!str", yaml.DoubleQuotedStyle)
+}
+
+// setInt sets key to an integer, appending the key if it is missing
+func setInt(m *yaml.Node, key string, value int) (string, bool) {
+	return setScalar(m, key, strconv.Itoa(value), "!!int", 0)
+}
+
+func setScalar(m *yaml.Node, key, value, tag string, style yaml.Style) (string, bool) {
+	if node := mappingValue(m, key); node != nil {
+		if node.Kind == yaml.ScalarNode && node.Value == value {
+			return value, false
+		}
+		old := node.Value
+		// Keep the existing quoting style where it is still valid
+		if node.Kind != yaml.ScalarNode || node.Tag != tag {
+			node.Style = style
+		}
+		node.Kind = yaml.ScalarNode
+		node.Tag = tag
+		node.Value = value
+		node.Content = nil
+		return old, true
+	}
+
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Style: style},
+	)
+	return "", true
+}
@@ -1,22 +1,24 @@
 package server
 
 import (
+	"archive/zip"
 	"fmt"
 	"html/template"
-	"io"
+	"io/fs"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/davesmith10/rice-cli/pkg/manifest"
+	"github.com/davesmith10/rice-cli/pkg/ricecake"
 	"gopkg.in/yaml.v3"
 )
 
 // PreviewServer serves bundle content for testing
 type PreviewServer struct {
 	bundlePath string
+	fsys       fs.FS
 	port       int
 	verbose    bool
 }
@@ -30,8 +32,16 @@ func NewPreviewServer(bundlePath string, port int, verbose bool) *PreviewServer
 	}
 }
 
-// Start starts the preview server
+// Start starts the preview server. Source directories and .ricecake
+// archives are both served in place, without extraction.
 func (s *PreviewServer) Start() error {
+	b, err := ricecake.Open(s.bundlePath)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	s.fsys = b.FS()
+
 	mux := http.NewServeMux()
 
 	// Serve the preview page
@@ -68,8 +78,7 @@ func (s *PreviewServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load manifest
-	manifestPath := filepath.Join(s.bundlePath, "manifest.yaml")
-	data, err := os.ReadFile(manifestPath)
+	data, err := fs.ReadFile(s.fsys, "manifest.yaml")
 	if err != nil {
 		http.Error(w, "Failed to read manifest", http.StatusInternalServerError)
 		return
@@ -86,7 +95,28 @@ func (s *PreviewServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, m)
 }
 
+// contentTypes maps every servable extension to its MIME type
+var contentTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".txt":  "text/plain; charset=utf-8",
+	".yaml": "text/yaml; charset=utf-8",
+	".yml":  "text/yaml; charset=utf-8",
+	".sig":  "text/plain; charset=utf-8",
+}
+
 func (s *PreviewServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	// Get requested file path
 	filePath := strings.TrimPrefix(r.URL.Path, "/files/")
 	if filePath == "" {
@@ -95,55 +125,47 @@ func (s *PreviewServer) handleFiles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Security: prevent path traversal
-	if strings.Contains(filePath, "..") {
+	if strings.Contains(filePath, "..") || !fs.ValidPath(filePath) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	fullPath := filepath.Join(s.bundlePath, filePath)
-
 	// Check file exists
-	info, err := os.Stat(fullPath)
+	info, err := fs.Stat(s.fsys, filePath)
 	if err != nil || info.IsDir() {
 		http.NotFound(w, r)
 		return
 	}
 
 	// Set content type
-	ext := strings.ToLower(filepath.Ext(fullPath))
-	switch ext {
-	case ".mp3":
-		w.Header().Set("Content-Type", "audio/mpeg")
-	case ".flac":
-		w.Header().Set("Content-Type", "audio/flac")
-	case ".ogg":
-		w.Header().Set("Content-Type", "audio/ogg")
-	case ".wav":
-		w.Header().Set("Content-Type", "audio/wav")
-	case ".jpg", ".jpeg":
-		w.Header().Set("Content-Type", "image/jpeg")
-	case ".png":
-		w.Header().Set("Content-Type", "image/png")
-	case ".txt":
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	case ".yaml", ".yml":
-		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	ext := strings.ToLower(path.Ext(filePath))
+	if contentType, ok := contentTypes[ext]; ok {
+		w.Header().Set("Content-Type", contentType)
 	}
+	w.Header().Set("ETag", etag(info))
 
-	// Serve file
-	file, err := os.Open(fullPath)
+	// Serve file with range, conditional request and HEAD support
+	content, err := openSeekable(s.fsys, filePath, info.Size())
 	if err != nil {
 		http.Error(w, "Failed to open file", http.StatusInternalServerError)
 		return
 	}
-	defer file.Close()
+	defer content.Close()
 
-	io.Copy(w, file)
+	http.ServeContent(w, r, path.Base(filePath), info.ModTime(), content)
+}
+
+// etag returns a strong entity tag for a file, using the CRC-32 for
+// archive entries and the modification time for files on disk
+func etag(info fs.FileInfo) string {
+	if header, ok := info.Sys().(*zip.FileHeader); ok {
+		return fmt.Sprintf(`"%08x-%x"`, header.CRC32, info.Size())
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
 }
 
 func (s *PreviewServer) handleManifest(w http.ResponseWriter, r *http.Request) {
-	manifestPath := filepath.Join(s.bundlePath, "manifest.yaml")
-	data, err := os.ReadFile(manifestPath)
+	data, err := fs.ReadFile(s.fsys, "manifest.yaml")
 	if err != nil {
 		http.Error(w, "Failed to read manifest", http.StatusInternalServerError)
 		return
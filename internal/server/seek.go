@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// readSeekCloser is the content interface needed by http.ServeContent
+type readSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// openSeekable opens name in fsys for random access. Files on disk are
+// seekable already; compressed archive entries are wrapped so that seeking
+// reopens the entry and skips forward to the requested offset.
+func openSeekable(fsys fs.FS, name string, size int64) (readSeekCloser, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rsc, ok := file.(readSeekCloser); ok {
+		return rsc, nil
+	}
+
+	return &lazySeeker{fsys: fsys, name: name, size: size, file: file}, nil
+}
+
+// lazySeeker emulates seeking over a forward-only file
+type lazySeeker struct {
+	fsys fs.FS
+	name string
+	size int64
+
+	file    fs.File
+	filePos int64 // offset the open file will read from next
+	pos     int64 // offset requested by the caller
+}
+
+func (l *lazySeeker) Read(p []byte) (int, error) {
+	if l.pos >= l.size {
+		return 0, io.EOF
+	}
+
+	// Seeking backwards needs a fresh stream
+	if l.file == nil || l.pos < l.filePos {
+		if l.file != nil {
+			l.file.Close()
+		}
+		file, err := l.fsys.Open(l.name)
+		if err != nil {
+			l.file = nil
+			return 0, err
+		}
+		l.file = file
+		l.filePos = 0
+	}
+
+	// Skip forward to the requested offset
+	if l.pos > l.filePos {
+		n, err := io.CopyN(io.Discard, l.file, l.pos-l.filePos)
+		l.filePos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Read(p)
+	l.filePos += int64(n)
+	l.pos = l.filePos
+	return n, err
+}
+
+func (l *lazySeeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = l.pos + offset
+	case io.SeekEnd:
+		pos = l.size + offset
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	l.pos = pos
+	return pos, nil
+}
+
+func (l *lazySeeker) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
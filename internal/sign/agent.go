@@ -0,0 +1,108 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AgentSigner signs with an Ed25519 key held by a running ssh-agent, so
+// the private key never leaves the agent
+type AgentSigner struct {
+	conn      net.Conn
+	agent     agent.Agent
+	key       ssh.PublicKey
+	publicKey ed25519.PublicKey
+}
+
+// NewAgentSigner connects to the ssh-agent at $SSH_AUTH_SOCK and selects
+// the key matching publicKey. If publicKey is nil the agent must hold
+// exactly one Ed25519 key.
+func NewAgentSigner(publicKey ed25519.PublicKey) (*AgentSigner, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK is not set: start ssh-agent and add your key with ssh-add")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+
+	s := &AgentSigner{conn: conn, agent: agent.NewClient(conn)}
+	if err := s.selectKey(publicKey); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *AgentSigner) selectKey(want ed25519.PublicKey) error {
+	keys, err := s.agent.List()
+	if err != nil {
+		return fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+
+	var matches []ssh.PublicKey
+	var found []ed25519.PublicKey
+	for _, key := range keys {
+		if key.Type() != ssh.KeyAlgoED25519 {
+			continue
+		}
+		parsed, err := ssh.ParsePublicKey(key.Marshal())
+		if err != nil {
+			continue
+		}
+		publicKey, err := sshPublicKey(parsed)
+		if err != nil {
+			continue
+		}
+		if want == nil || publicKey.Equal(want) {
+			matches = append(matches, parsed)
+			found = append(found, publicKey)
+		}
+	}
+
+	switch {
+	case len(matches) == 1:
+		s.key, s.publicKey = matches[0], found[0]
+		return nil
+	case want != nil:
+		return fmt.Errorf("ssh-agent does not hold the key %s", Fingerprint(want))
+	case len(matches) == 0:
+		return fmt.Errorf("ssh-agent holds no Ed25519 keys")
+	default:
+		return fmt.Errorf("ssh-agent holds %d Ed25519 keys: choose one with --key", len(matches))
+	}
+}
+
+// Public returns the Ed25519 public key of the selected agent key
+func (s *AgentSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign asks the agent to sign message. Like ed25519.PrivateKey, it signs
+// the message itself, so opts must not name a hash.
+func (s *AgentSigner) Sign(_ io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, fmt.Errorf("ed25519: cannot sign hashed message")
+	}
+	sig, err := s.agent.Sign(s.key, message)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent refused to sign: %w", err)
+	}
+	if sig.Format != ssh.KeyAlgoED25519 || len(sig.Blob) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("ssh-agent returned an unexpected %s signature", sig.Format)
+	}
+	return sig.Blob, nil
+}
+
+// Close closes the connection to the agent
+func (s *AgentSigner) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,138 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CommandSigner delegates signing to an external program, such as a
+// wrapper around an HSM or a cloud key service. The program receives the
+// message to sign on stdin and writes the 64-byte Ed25519 signature to
+// stdout, raw or base64 encoded.
+type CommandSigner struct {
+	args      []string
+	publicKey ed25519.PublicKey
+}
+
+// NewCommandSigner creates a signer that runs command for the key
+// publicKey. The command is split into arguments the way a POSIX shell
+// splits words, so quoted arguments and paths with spaces work, but it is
+// not run by a shell. The command is given the key's fingerprint in
+// RICE_KEY_FINGERPRINT.
+func NewCommandSigner(command string, publicKey ed25519.PublicKey) (*CommandSigner, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer command: %w", err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("signer command is empty")
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("signer command needs the public key it signs for")
+	}
+	return &CommandSigner{args: args, publicKey: publicKey}, nil
+}
+
+// Public returns the public key the command signs for
+func (s *CommandSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign runs the command with message on stdin. Ed25519 signs the message
+// itself, so opts must not name a hash. For bundles the message is the
+// signature header block, which includes the SHA-256 content hash.
+func (s *CommandSigner) Sign(_ io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, fmt.Errorf("ed25519: cannot sign hashed message")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.args[0], s.args[1:]...)
+	cmd.Stdin = bytes.NewReader(message)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "RICE_KEY_FINGERPRINT="+Fingerprint(s.publicKey))
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("signer command failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("signer command failed: %w", err)
+	}
+
+	output := stdout.Bytes()
+	if len(output) == ed25519.SignatureSize {
+		return output, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("signer command must print a %d-byte signature, raw or base64", ed25519.SignatureSize)
+	}
+	return decoded, nil
+}
+
+// splitCommand splits command into words following POSIX shell quoting:
+// single quotes keep everything literally, double quotes keep everything
+// but a backslash before ", \, $ or `, and a backslash outside quotes
+// escapes the next character. Expansions and operators are not supported.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\\':
+			if i++; i == len(command) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			if command[i] == '\n' {
+				continue // line continuation
+			}
+			word.WriteByte(command[i])
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			for i++; ; i++ {
+				if i == len(command) {
+					return nil, fmt.Errorf("unterminated double quote")
+				}
+				if command[i] == '"' {
+					break
+				}
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`\n", command[i+1]) >= 0 {
+					if i++; command[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(command[i])
+			}
+		default:
+			word.WriteByte(c)
+		}
+		inWord = true
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,99 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{command: "", want: nil},
+		{command: "  hsm-sign  --slot 1 ", want: []string{"hsm-sign", "--slot", "1"}},
+		{command: `"/opt/My Signer/sign" --label 'release key'`, want: []string{"/opt/My Signer/sign", "--label", "release key"}},
+		{command: `/opt/My\ Signer/sign`, want: []string{"/opt/My Signer/sign"}},
+		{command: `sign --name=""`, want: []string{"sign", "--name="}},
+		{command: `sign '' x`, want: []string{"sign", "", "x"}},
+		{command: `sign 'it'\''s'`, want: []string{"sign", "it's"}},
+		{command: `sign "a \"b\" \$c \d"`, want: []string{"sign", `a "b" $c \d`}},
+		{command: `sign '\n $HOME'`, want: []string{"sign", `\n $HOME`}},
+		{command: "sign \\\n  --slot 1", want: []string{"sign", "--slot", "1"}},
+		{command: `sign 'open`, wantErr: true},
+		{command: `sign "open`, wantErr: true},
+		{command: `sign \`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandSigner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	publicKey, privateKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("Signature-Version: 1\nContent-Hash: sha256:00\n")
+	signature := ed25519.Sign(privateKey, message)
+
+	// The script prints the signature it is given and saves its stdin, from
+	// a directory whose name needs quoting
+	dir := filepath.Join(t.TempDir(), "signer dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "sign.sh")
+	stdin := filepath.Join(dir, "stdin")
+	body := "#!/bin/sh\ncat > \"$2\"\nprintf '%s\\n' \"$1\"\n[ \"$RICE_KEY_FINGERPRINT\" = \"$3\" ]\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+	command := strings.Join([]string{quote(script), base64.StdEncoding.EncodeToString(signature), quote(stdin), quote(Fingerprint(publicKey))}, " ")
+	signer, err := NewCommandSigner(command, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := signer.Sign(nil, message, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, signature) {
+		t.Error("returned signature differs from the command's output")
+	}
+	if data, err := os.ReadFile(stdin); err != nil || !bytes.Equal(data, message) {
+		t.Errorf("command read %q on stdin, want %q (%v)", data, message, err)
+	}
+
+	if _, err := NewCommandSigner(`sign "open`, publicKey); err == nil {
+		t.Error("unterminated quote accepted")
+	}
+}
@@ -0,0 +1,203 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+)
+
+// ScopeArchive marks a detached signature, which signs the SHA-256 of the
+// whole archive file rather than its checksum index
+const ScopeArchive = "archive"
+
+// DetachedPath returns the detached signature file for an archive:
+// my-album.ricecake.sig next to my-album.ricecake
+func DetachedPath(archivePath string) string {
+	return archivePath + ".sig"
+}
+
+// SignDetached signs a ricecake archive without modifying it, writing the
+// signature to DetachedPath(archivePath), which is returned. The file holds
+// one signature block per signer; with Append, blocks by other keys over
+// the same archive are kept.
+func (s *Signer) SignDetached(archivePath string) (string, error) {
+	if err := s.checkKey(); err != nil {
+		return "", err
+	}
+
+	reader, err := bundle.OpenArchive(archivePath)
+	if err != nil {
+		return "", err
+	}
+	bundleID, err := readBundleID(reader)
+	reader.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle ID: %w", err)
+	}
+
+	if s.verbose {
+		fmt.Println("Hashing archive...")
+	}
+	archiveHash, err := hashArchive(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	sigPath := DetachedPath(archivePath)
+	var content bytes.Buffer
+	if s.Append {
+		kept, err := s.keptDetached(sigPath, archiveHash)
+		if err != nil {
+			return "", err
+		}
+		for _, block := range kept {
+			content.Write(block)
+		}
+	}
+
+	if s.verbose {
+		fmt.Println("Generating signature...")
+	}
+	sigContent, err := s.createSignatureFile(bundleID, ScopeArchive, archiveHash)
+	if err != nil {
+		return "", err
+	}
+	content.WriteString(sigContent)
+
+	tmpPath := sigPath + ".tmp"
+	if err := os.WriteFile(tmpPath, content.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write signature: %w", err)
+	}
+	if err := os.Rename(tmpPath, sigPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return sigPath, nil
+}
+
+// keptDetached returns the signature blocks in the detached file sigPath
+// made by other keys, provided they sign the same archive
+func (s *Signer) keptDetached(sigPath string, archiveHash []byte) ([][]byte, error) {
+	data, err := os.ReadFile(sigPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sigPath, err)
+	}
+
+	ours := Fingerprint(s.publicKey())
+	var kept [][]byte
+	for _, block := range splitSignatures(data) {
+		sig, err := ParseSignature(block)
+		if err != nil {
+			return nil, fmt.Errorf("existing signature in %s: %w", sigPath, err)
+		}
+		if sig.KeyFingerprint == ours {
+			continue // Re-signing replaces our own signature
+		}
+		if sig.Scope != ScopeArchive || !bytes.Equal(sig.ContentHash, archiveHash) {
+			return nil, fmt.Errorf("existing signature in %s by %s does not cover the current archive", sigPath, sig.KeyFingerprint)
+		}
+		kept = append(kept, block)
+	}
+	return kept, nil
+}
+
+// VerifyDetached checks the signatures in the detached signature file of
+// the archive at archivePath, opened as fsys. It returns ErrUnsigned if
+// the archive has no detached signature file.
+func VerifyDetached(fsys fs.FS, archivePath string, trust *Trust) ([]Result, error) {
+	sigPath := DetachedPath(archivePath)
+	data, err := os.ReadFile(sigPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrUnsigned
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read detached signature: %w", err)
+	}
+
+	archiveHash, err := hashArchive(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(sigPath)
+	blocks := splitSignatures(data)
+	if len(blocks) == 0 {
+		return []Result{{File: name, Err: fmt.Errorf("%w: missing signature block markers", ErrMalformed)}}, nil
+	}
+
+	v := &verifier{fsys: fsys, trust: trust, archiveHash: archiveHash}
+	results := make([]Result, 0, len(blocks))
+	for _, block := range blocks {
+		results = append(results, v.checkData(name, block))
+	}
+	return results, nil
+}
+
+// VerifyArchive checks the signatures embedded in the archive at
+// archivePath, opened as fsys, followed by those in its detached
+// signature file, if it has one
+func VerifyArchive(fsys fs.FS, archivePath string, trust *Trust) ([]Result, error) {
+	results, err := VerifyAllFS(fsys, trust)
+	if err != nil && !errors.Is(err, ErrUnsigned) {
+		return nil, err
+	}
+
+	detached, detachedErr := VerifyDetached(fsys, archivePath, trust)
+	switch {
+	case detachedErr == nil:
+		return append(results, detached...), nil
+	case errors.Is(detachedErr, ErrUnsigned):
+		return results, err
+	default:
+		return nil, detachedErr
+	}
+}
+
+// splitSignatures splits a detached signature file into its signature
+// blocks, each with the timestamp token that follows it, if any
+func splitSignatures(data []byte) [][]byte {
+	text := string(data)
+	var blocks [][]byte
+	for {
+		start := strings.Index(text, signatureBegin)
+		if start < 0 {
+			return blocks
+		}
+		text = text[start:]
+
+		end := strings.Index(text[len(signatureBegin):], signatureBegin)
+		if end < 0 {
+			return append(blocks, []byte(text))
+		}
+		end += len(signatureBegin)
+		blocks = append(blocks, []byte(text[:end]))
+		text = text[end:]
+	}
+}
+
+// hashArchive returns the SHA-256 of the archive file
+func hashArchive(archivePath string) ([]byte, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("failed to hash archive: %w", err)
+	}
+	return hash.Sum(nil), nil
+}
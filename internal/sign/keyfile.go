@@ -0,0 +1,465 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// encryptedKeyType is the PEM type of a passphrase-protected private key.
+// The headers record the public key and the KDF and cipher parameters, so
+// the key can be identified without the passphrase.
+const encryptedKeyType = "RICE ENCRYPTED PRIVATE KEY"
+
+// scrypt cost parameters for new keys. Keys are decrypted once per
+// command, so the cost can be high.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// maxScryptN bounds the cost a key file can demand when it is loaded
+	maxScryptN = 1 << 20
+)
+
+var (
+	// ErrPassphraseRequired is returned when an encrypted key is loaded
+	// without a way to obtain its passphrase
+	ErrPassphraseRequired = errors.New("key is encrypted and requires a passphrase")
+
+	// ErrIncorrectPassphrase is returned when an encrypted key cannot be
+	// decrypted with the passphrase given
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+)
+
+// PassphraseFunc returns the passphrase of an encrypted key. It is only
+// called when the key is encrypted.
+type PassphraseFunc func() ([]byte, error)
+
+// IsEncryptedKey reports whether data is a passphrase-protected private key
+func IsEncryptedKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	switch block.Type {
+	case encryptedKeyType, "ENCRYPTED PRIVATE KEY":
+		return true
+	case "OPENSSH PRIVATE KEY":
+		_, err := ssh.ParseRawPrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		return errors.As(err, &missing)
+	}
+	return false
+}
+
+// KeyFilePublicKey returns the public half of a private key file. Keys
+// encrypted by rice or ssh-keygen are not decrypted; their public key is
+// read from the file. Encrypted PKCS#8 keys do not record it, so they are
+// decrypted with the passphrase returned by passphrase, which may be nil
+// if none can be asked for.
+func KeyFilePublicKey(data []byte, passphrase PassphraseFunc) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case encryptedKeyType:
+			return encryptedPublicKey(block)
+		case "OPENSSH PRIVATE KEY":
+			_, err := ssh.ParseRawPrivateKey(data)
+			var missing *ssh.PassphraseMissingError
+			if errors.As(err, &missing) && missing.PublicKey != nil {
+				return sshPublicKey(missing.PublicKey)
+			}
+		}
+	}
+	privateKey, err := ParsePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey.Public().(ed25519.PublicKey), nil
+}
+
+// Key file formats
+const (
+	// FormatRaw is the PEM-wrapped raw key written by earlier versions
+	FormatRaw = "raw"
+
+	// FormatPKCS8 is PKCS#8 for private keys and PKIX for public keys, as
+	// used by openssl
+	FormatPKCS8 = "pkcs8"
+
+	// FormatOpenSSH is the format of ssh-keygen: an OpenSSH private key
+	// and an authorized_keys line
+	FormatOpenSSH = "openssh"
+)
+
+// Formats lists the key file formats
+var Formats = []string{FormatRaw, FormatPKCS8, FormatOpenSSH}
+
+// ValidateFormat checks that format is one of Formats
+func ValidateFormat(format string) error {
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key format %q (expected raw, pkcs8 or openssh)", format)
+}
+
+// KeyFileFormat returns the format of a private key file. Keys encrypted
+// by rice are reported as raw, since only raw keys are encrypted that way.
+func KeyFileFormat(data []byte) string {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return FormatRaw
+	}
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return FormatOpenSSH
+	case "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		if len(block.Bytes) != ed25519.PrivateKeySize {
+			return FormatPKCS8
+		}
+	}
+	return FormatRaw
+}
+
+// MarshalPrivateKey encodes a private key in format. If passphrase is not
+// empty the key is encrypted in the way its format defines: OpenSSH keys
+// as ssh-keygen does, PKCS#8 keys as encrypted PKCS#8 and raw keys with
+// EncryptPrivateKey.
+func MarshalPrivateKey(privateKey ed25519.PrivateKey, format string, passphrase []byte) ([]byte, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+
+	if format == FormatOpenSSH {
+		var block *pem.Block
+		var err error
+		if len(passphrase) > 0 {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", passphrase)
+		} else {
+			block, err = ssh.MarshalPrivateKey(privateKey, "")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode OpenSSH key: %w", err)
+		}
+		return pem.EncodeToMemory(block), nil
+	}
+
+	if format == FormatPKCS8 && len(passphrase) > 0 {
+		return encryptPKCS8(privateKey, passphrase)
+	}
+	if len(passphrase) > 0 {
+		return EncryptPrivateKey(privateKey, passphrase)
+	}
+	if format == FormatPKCS8 {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode PKCS#8 key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+	return EncodePrivateKey(privateKey), nil
+}
+
+// MarshalPublicKey encodes a public key in format
+func MarshalPublicKey(publicKey ed25519.PublicKey, format string) ([]byte, error) {
+	switch format {
+	case FormatRaw:
+		return EncodePublicKey(publicKey), nil
+	case FormatPKCS8:
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode PKIX key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case FormatOpenSSH:
+		sshKey, err := ssh.NewPublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode OpenSSH key: %w", err)
+		}
+		return ssh.MarshalAuthorizedKey(sshKey), nil
+	}
+	return nil, ValidateFormat(format)
+}
+
+// EncryptPrivateKey returns the PEM encoding of a private key protected by
+// passphrase. The key is encrypted with AES-256-GCM under a key derived
+// with scrypt.
+func EncryptPrivateKey(privateKey ed25519.PrivateKey, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := keyCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// The public key is authenticated, so its header cannot be swapped
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	ciphertext := aead.Seal(nil, nonce, privateKey.Seed(), publicKey)
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: encryptedKeyType,
+		Headers: map[string]string{
+			"Public-Key": base64.StdEncoding.EncodeToString(publicKey),
+			"KDF":        "scrypt",
+			"KDF-Params": fmt.Sprintf("N=%d,r=%d,p=%d", scryptN, scryptR, scryptP),
+			"Salt":       base64.StdEncoding.EncodeToString(salt),
+			"Cipher":     "AES-256-GCM",
+			"Nonce":      base64.StdEncoding.EncodeToString(nonce),
+		},
+		Bytes: ciphertext,
+	}), nil
+}
+
+// ParsePrivateKey parses a PEM (raw, PKCS#8 or OpenSSH) or base64 private
+// key. Encrypted keys are decrypted with the passphrase returned by
+// passphrase, which may be nil if only plaintext keys are expected.
+func ParsePrivateKey(data []byte, passphrase PassphraseFunc) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		// Try raw base64
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key: not PEM or base64")
+		}
+		if len(decoded) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.PrivateKeySize, len(decoded))
+		}
+		return ed25519.PrivateKey(decoded), nil
+	}
+
+	switch block.Type {
+	case encryptedKeyType:
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		secret, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		return decryptPrivateKey(block, secret)
+
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(data, passphrase)
+
+	case "PRIVATE KEY":
+		// Earlier versions wrote the raw key under the PKCS#8 type
+		if len(block.Bytes) == ed25519.PrivateKeySize {
+			return ed25519.PrivateKey(block.Bytes), nil
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 key: %w", err)
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key algorithm %T: bundles are signed with Ed25519 keys", key)
+		}
+		return privateKey, nil
+
+	case "ED25519 PRIVATE KEY":
+		if len(block.Bytes) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.PrivateKeySize, len(block.Bytes))
+		}
+		return ed25519.PrivateKey(block.Bytes), nil
+
+	case "ENCRYPTED PRIVATE KEY":
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		secret, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		return decryptPKCS8(block.Bytes, secret)
+
+	default:
+		return nil, fmt.Errorf("unexpected key type: %s", block.Type)
+	}
+}
+
+// parseOpenSSHPrivateKey parses a key written by ssh-keygen -t ed25519,
+// asking for the passphrase if it is encrypted
+func parseOpenSSHPrivateKey(data []byte, passphrase PassphraseFunc) (ed25519.PrivateKey, error) {
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		secret, perr := passphrase()
+		if perr != nil {
+			return nil, perr
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, secret)
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenSSH key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		return *k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %T: bundles are signed with Ed25519 keys", key)
+}
+
+// ParsePublicKey parses a PEM (PKIX or raw), base64 or OpenSSH
+// authorized_keys public key
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("ssh-")) {
+		key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OpenSSH public key: %w", err)
+		}
+		return sshPublicKey(key)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		// Try raw base64
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key: not PEM, base64 or OpenSSH")
+		}
+		if len(decoded) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.PublicKeySize, len(decoded))
+		}
+		return ed25519.PublicKey(decoded), nil
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		// Earlier versions wrote the raw key under the PKIX type
+		if len(block.Bytes) == ed25519.PublicKeySize {
+			return ed25519.PublicKey(block.Bytes), nil
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKIX public key: %w", err)
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key algorithm %T: bundles are signed with Ed25519 keys", key)
+		}
+		return publicKey, nil
+
+	case "ED25519 PUBLIC KEY":
+		if len(block.Bytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.PublicKeySize, len(block.Bytes))
+		}
+		return ed25519.PublicKey(block.Bytes), nil
+
+	default:
+		return nil, fmt.Errorf("unexpected key type: %s", block.Type)
+	}
+}
+
+func sshPublicKey(key ssh.PublicKey) (ed25519.PublicKey, error) {
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported OpenSSH key type %s", key.Type())
+	}
+	publicKey, ok := cryptoKey.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported OpenSSH key type %s: bundles are signed with Ed25519 keys", key.Type())
+	}
+	return publicKey, nil
+}
+
+func decryptPrivateKey(block *pem.Block, passphrase []byte) (ed25519.PrivateKey, error) {
+	publicKey, err := encryptedPublicKey(block)
+	if err != nil {
+		return nil, err
+	}
+	if kdf := block.Headers["KDF"]; kdf != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", kdf)
+	}
+	if c := block.Headers["Cipher"]; c != "AES-256-GCM" {
+		return nil, fmt.Errorf("unsupported key cipher %q", c)
+	}
+
+	var n, r, p int
+	if _, err := fmt.Sscanf(block.Headers["KDF-Params"], "N=%d,r=%d,p=%d", &n, &r, &p); err != nil {
+		return nil, fmt.Errorf("invalid KDF-Params header")
+	}
+	if n > maxScryptN || r > 32 || p > 16 {
+		return nil, fmt.Errorf("key derivation cost N=%d,r=%d,p=%d is too high", n, r, p)
+	}
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Salt header")
+	}
+	nonce, err := base64.StdEncoding.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Nonce header")
+	}
+
+	aead, err := keyCipher(passphrase, salt, n, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid Nonce header")
+	}
+	seed, err := aead.Open(nil, nonce, block.Bytes, publicKey)
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	if !publicKey.Equal(privateKey.Public()) {
+		return nil, fmt.Errorf("decrypted key does not match its Public-Key header")
+	}
+	return privateKey, nil
+}
+
+func encryptedPublicKey(block *pem.Block) (ed25519.PublicKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(block.Headers["Public-Key"])
+	if err != nil || len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("encrypted key has an invalid Public-Key header")
+	}
+	return ed25519.PublicKey(decoded), nil
+}
+
+func keyCipher(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,52 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Signer roles recorded in a signature
+const (
+	RoleArtist      = "artist"
+	RoleLabel       = "label"
+	RoleDistributor = "distributor"
+)
+
+// Roles lists the valid signer roles
+var Roles = []string{RoleArtist, RoleLabel, RoleDistributor}
+
+// ValidateRole checks that role is one of Roles
+func ValidateRole(role string) error {
+	for _, r := range Roles {
+		if role == r {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q (expected artist, label or distributor)", role)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a public key as
+// ssh-keygen -l prints it, e.g. "SHA256:r4Nd...": the digest of the key in
+// SSH wire format
+func Fingerprint(publicKey ed25519.PublicKey) string {
+	wire := append(sshString([]byte("ssh-ed25519")), sshString(publicKey)...)
+	sum := sha256.Sum256(wire)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// sshString encodes b as an SSH wire format string: its length as a
+// 32-bit big-endian integer followed by the bytes
+func sshString(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+// KeyID returns a short identifier for a public key: the first 8 bytes of
+// its SHA-256 digest in hex
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,31 @@
+package sign
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFingerprintMatchesSSHKeygen(t *testing.T) {
+	// ssh-keygen -lf prints SHA256://8PGg7fr4kWoqELb1ZuORzzxL3f+ps5f+UzuKzIpGE
+	publicKey, err := ParsePublicKey([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJqg4ZNt4oW8TRMJ11ZjvR2GkEwUaxKNDJn619V8dUIK"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SHA256://8PGg7fr4kWoqELb1ZuORzzxL3f+ps5f+UzuKzIpGE"
+	if got := Fingerprint(publicKey); got != want {
+		t.Errorf("Fingerprint = %s, want %s", got, want)
+	}
+
+	generated, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey, err := ssh.NewPublicKey(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Fingerprint(generated), ssh.FingerprintSHA256(sshKey); got != want {
+		t.Errorf("Fingerprint = %s, want %s", got, want)
+	}
+}
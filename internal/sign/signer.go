@@ -2,6 +2,8 @@ package sign
 
 import (
 	"archive/zip"
+	"bytes"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
@@ -9,58 +11,65 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/davesmith10/rice-cli/internal/bundle"
 )
 
 // Signer handles bundle signing operations
 type Signer struct {
-	privateKey ed25519.PrivateKey
-	verbose    bool
+	key     crypto.Signer
+	verbose bool
+
+	// Role is recorded in the signature: artist, label or distributor
+	Role string
+
+	// Append keeps signatures made by other keys instead of replacing them
+	Append bool
+
+	// ValidFrom and ValidUntil declare the key's validity period in the
+	// signature, if set. Signing outside the period fails.
+	ValidFrom  time.Time
+	ValidUntil time.Time
+
+	// Timestamper, if set, timestamps the signature
+	Timestamper Timestamper
 }
 
-// NewSigner creates a new signer with the given private key
-func NewSigner(privateKey ed25519.PrivateKey, verbose bool) *Signer {
+// NewSigner creates a new signer, signing in the artist role. key is an
+// ed25519.PrivateKey, or any crypto.Signer holding an Ed25519 key, such as
+// an AgentSigner or CommandSigner.
+func NewSigner(key crypto.Signer, verbose bool) *Signer {
 	return &Signer{
-		privateKey: privateKey,
-		verbose:    verbose,
+		key:     key,
+		verbose: verbose,
+		Role:    RoleArtist,
 	}
 }
 
-// LoadPrivateKey loads an Ed25519 private key from a file
-func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+// SignatureName returns the path of the signature file this signer writes
+func (s *Signer) SignatureName() string {
+	return path.Join(bundle.SignaturesDir, KeyID(s.publicKey())+".sig")
+}
+
+func (s *Signer) publicKey() ed25519.PublicKey {
+	publicKey, _ := s.key.Public().(ed25519.PublicKey)
+	return publicKey
+}
+
+// LoadPrivateKey loads an Ed25519 private key from a file. If the key is
+// encrypted, passphrase is called to obtain its passphrase.
+func LoadPrivateKey(path string, passphrase PassphraseFunc) (ed25519.PrivateKey, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read key file: %w", err)
 	}
-
-	block, _ := pem.Decode(data)
-	if block == nil {
-		// Try raw base64
-		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode key: not PEM or base64")
-		}
-		if len(decoded) != ed25519.PrivateKeySize {
-			return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.PrivateKeySize, len(decoded))
-		}
-		return ed25519.PrivateKey(decoded), nil
-	}
-
-	if block.Type != "PRIVATE KEY" && block.Type != "ED25519 PRIVATE KEY" {
-		return nil, fmt.Errorf("unexpected key type: %s", block.Type)
-	}
-
-	if len(block.Bytes) != ed25519.PrivateKeySize {
-		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", ed25519.PrivateKeySize, len(block.Bytes))
-	}
-
-	return ed25519.PrivateKey(block.Bytes), nil
+	return ParsePrivateKey(data, passphrase)
 }
 
 // LoadPrivateKeyFromEnv loads a private key from an environment variable
@@ -82,102 +91,271 @@ func LoadPrivateKeyFromEnv(envVar string) (ed25519.PrivateKey, error) {
 	return ed25519.PrivateKey(decoded), nil
 }
 
-// SignBundle signs a ricecake bundle
+// checkKey checks that the signer has an Ed25519 key it may sign with now
+func (s *Signer) checkKey() error {
+	if err := ValidateRole(s.Role); err != nil {
+		return err
+	}
+	if s.publicKey() == nil {
+		return fmt.Errorf("unsupported key type %T: bundles are signed with Ed25519 keys", s.key.Public())
+	}
+	now := time.Now()
+	if !s.ValidFrom.IsZero() && now.Before(s.ValidFrom) {
+		return fmt.Errorf("key is not valid until %s", s.ValidFrom.Format(time.RFC3339))
+	}
+	if !s.ValidUntil.IsZero() && now.After(s.ValidUntil) {
+		return fmt.Errorf("key expired on %s", s.ValidUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SignBundle signs a ricecake bundle. Entries are hashed straight from the
+// archive into checksums.yaml, whose digest is signed, and copied without
+// recompression, so only the index and signature files can change.
 func (s *Signer) SignBundle(bundlePath string) error {
-	// Create temp directory for extraction
-	tempDir, err := os.MkdirTemp("", "rice-sign-*")
+	if err := s.checkKey(); err != nil {
+		return err
+	}
+
+	reader, err := bundle.OpenArchive(bundlePath)
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return err
 	}
-	defer os.RemoveAll(tempDir)
+	defer reader.Close()
 
-	// Extract bundle
-	if s.verbose {
-		fmt.Println("Extracting bundle...")
+	bundleID, err := readBundleID(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle ID: %w", err)
 	}
-	if err := extractBundle(bundlePath, tempDir); err != nil {
-		return fmt.Errorf("failed to extract bundle: %w", err)
+
+	index, contentHash, err := s.checksumIndex(reader)
+	if err != nil {
+		return err
 	}
 
-	// Read manifest to get bundle ID
-	manifestPath := filepath.Join(tempDir, "manifest.yaml")
-	manifestData, err := os.ReadFile(manifestPath)
+	// Decide which existing signatures survive
+	keep, err := s.keptSignatures(reader, contentHash)
 	if err != nil {
-		return fmt.Errorf("failed to read manifest: %w", err)
+		return err
 	}
 
-	var manifest struct {
-		Bundle struct {
-			BundleID string `yaml:"bundle_id"`
-		} `yaml:"bundle"`
+	// Generate signature
+	if s.verbose {
+		fmt.Println("Generating signature...")
 	}
-	if err := yaml.Unmarshal(manifestData, &manifest); err != nil {
-		return fmt.Errorf("failed to parse manifest: %w", err)
+	sigContent, err := s.createSignatureFile(bundleID, "", contentHash)
+	if err != nil {
+		return err
 	}
 
-	// Compute content hash
+	// Rewrite bundle
 	if s.verbose {
-		fmt.Println("Computing content hash...")
+		fmt.Println("Writing signature into bundle...")
 	}
-	contentHash, err := s.computeContentHash(tempDir)
+
+	newBundlePath := bundlePath + ".tmp"
+	if err := writeSignedBundle(reader.Reader(), newBundlePath, index, keep, s.SignatureName(), []byte(sigContent)); err != nil {
+		os.Remove(newBundlePath)
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	// Replace original bundle
+	if err := os.Rename(newBundlePath, bundlePath); err != nil {
+		os.Remove(newBundlePath)
+		return fmt.Errorf("failed to replace bundle: %w", err)
+	}
+
+	return nil
+}
+
+// SignDirectory signs a bundle source directory before it is built. It
+// writes checksums.yaml and the signature into the directory; rice build
+// regenerates an identical index, so the signature carries over into the
+// bundle as long as no file changes in between.
+func (s *Signer) SignDirectory(dir string) error {
+	if err := s.checkKey(); err != nil {
+		return err
+	}
+
+	source := os.DirFS(dir)
+	bundleID, err := readBundleID(source)
 	if err != nil {
-		return fmt.Errorf("failed to compute content hash: %w", err)
+		return fmt.Errorf("failed to read bundle ID: %w", err)
+	}
+
+	index, contentHash, err := s.checksumIndex(source)
+	if err != nil {
+		return err
+	}
+
+	keep, err := s.keptSignatures(source, contentHash)
+	if err != nil {
+		return err
 	}
 
-	// Generate signature
 	if s.verbose {
 		fmt.Println("Generating signature...")
 	}
-	signature := ed25519.Sign(s.privateKey, contentHash)
+	sigContent, err := s.createSignatureFile(bundleID, "", contentHash)
+	if err != nil {
+		return err
+	}
 
-	// Create signature file
-	sigContent := s.createSignatureFile(manifest.Bundle.BundleID, contentHash, signature)
-	sigPath := filepath.Join(tempDir, "signature.sig")
+	if s.verbose {
+		fmt.Println("Writing signature into directory...")
+	}
+	files, err := SignatureFiles(source)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if !keep[name] {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, bundle.ChecksumsFile), index, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", bundle.ChecksumsFile, err)
+	}
+	sigPath := filepath.Join(dir, filepath.FromSlash(s.SignatureName()))
+	if err := os.MkdirAll(filepath.Dir(sigPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", bundle.SignaturesDir, err)
+	}
 	if err := os.WriteFile(sigPath, []byte(sigContent), 0644); err != nil {
-		return fmt.Errorf("failed to write signature file: %w", err)
+		return fmt.Errorf("failed to write signature: %w", err)
 	}
 
-	// Rebuild bundle
+	return nil
+}
+
+// checksumIndex builds the checksums.yaml index of fsys and its digest,
+// which is what a signature signs
+func (s *Signer) checksumIndex(fsys fs.FS) ([]byte, []byte, error) {
 	if s.verbose {
-		fmt.Println("Rebuilding bundle with signature...")
+		fmt.Println("Computing checksums...")
+	}
+	checksums, err := bundle.ComputeChecksums(fsys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compute checksums: %w", err)
+	}
+	if s.verbose {
+		for _, file := range checksums.Files {
+			fmt.Printf("  Hashing %s\n", file.Path)
+		}
 	}
+	index, err := checksums.Marshal()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode checksums: %w", err)
+	}
+	contentHash := sha256.Sum256(index)
+	return index, contentHash[:], nil
+}
 
-	// Create new bundle path
-	newBundlePath := bundlePath + ".tmp"
-	if err := rebuildBundle(tempDir, newBundlePath); err != nil {
-		return fmt.Errorf("failed to rebuild bundle: %w", err)
+// keptSignatures returns the signature files to carry over. Without Append
+// none are kept. With it, every signature by another key is kept, provided
+// it signs the same checksum index.
+func (s *Signer) keptSignatures(fsys fs.FS, contentHash []byte) (map[string]bool, error) {
+	keep := make(map[string]bool)
+	if !s.Append {
+		return keep, nil
 	}
 
-	// Replace original bundle
-	if err := os.Remove(bundlePath); err != nil {
-		os.Remove(newBundlePath)
-		return fmt.Errorf("failed to remove original bundle: %w", err)
+	files, err := SignatureFiles(fsys)
+	if err != nil {
+		return nil, err
 	}
-	if err := os.Rename(newBundlePath, bundlePath); err != nil {
-		return fmt.Errorf("failed to rename bundle: %w", err)
+	for _, name := range files {
+		if name == s.SignatureName() {
+			continue // Re-signing replaces our own signature
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		sig, err := ParseSignature(data)
+		if err != nil {
+			return nil, fmt.Errorf("existing signature %s: %w", name, err)
+		}
+		if sig.Version == "1" {
+			return nil, fmt.Errorf("existing signature %s uses version 1, which cannot be combined with others (sign without --append to replace it)", name)
+		}
+		if !bytes.Equal(sig.ContentHash, contentHash) {
+			return nil, fmt.Errorf("existing signature %s does not cover the current bundle contents", name)
+		}
+		keep[name] = true
 	}
 
-	return nil
+	return keep, nil
+}
+
+// writeSignedBundle copies every entry of src except signatures not in
+// keep to destPath without recompressing it, then appends the new
+// signature as sigName. The checksum index is kept in place if unchanged,
+// otherwise replaced.
+func writeSignedBundle(src *zip.Reader, destPath string, index []byte, keep map[string]bool, sigName string, sigContent []byte) error {
+	outFile, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	writer := bundle.NewWriter(outFile)
+	writer.ModTime = bundle.BuildTime(src)
+
+	indexWritten := false
+	for _, file := range src.File {
+		if bundle.IsSignatureFile(file.Name) && !keep[file.Name] {
+			continue
+		}
+		if file.Name == bundle.ChecksumsFile {
+			if current, err := fs.ReadFile(src, file.Name); err != nil || !bytes.Equal(current, index) {
+				continue
+			}
+			indexWritten = true
+		}
+		if err := writer.Copy(file); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", file.Name, err)
+		}
+	}
+
+	if !indexWritten {
+		if err := writer.AddBytes(bundle.ChecksumsFile, index); err != nil {
+			return err
+		}
+	}
+	if err := writer.AddBytes(sigName, sigContent); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return outFile.Close()
 }
 
-func (s *Signer) computeContentHash(dir string) ([]byte, error) {
+// computeContentHash hashes every file in fsys except signature files, in
+// sorted path order, feeding each relative path followed by its contents.
+// Version 1 signatures sign this hash; version 3 signs checksums.yaml.
+func computeContentHash(fsys fs.FS, verbose bool) ([]byte, error) {
 	hash := sha256.New()
 
 	// Get all files sorted for deterministic hashing
 	var files []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if d.IsDir() {
 			return nil
 		}
 		// Skip signature file if it exists
-		if filepath.Base(path) == "signature.sig" {
+		if path.Base(name) == "signature.sig" {
 			return nil
 		}
-		relPath, _ := filepath.Rel(dir, path)
-		files = append(files, relPath)
+		files = append(files, name)
 		return nil
 	})
 	if err != nil {
@@ -187,13 +365,11 @@ func (s *Signer) computeContentHash(dir string) ([]byte, error) {
 	sort.Strings(files)
 
 	for _, relPath := range files {
-		fullPath := filepath.Join(dir, relPath)
-
 		// Hash the relative path
 		hash.Write([]byte(relPath))
 
 		// Hash the file contents
-		file, err := os.Open(fullPath)
+		file, err := fsys.Open(relPath)
 		if err != nil {
 			return nil, err
 		}
@@ -203,7 +379,7 @@ func (s *Signer) computeContentHash(dir string) ([]byte, error) {
 		}
 		file.Close()
 
-		if s.verbose {
+		if verbose {
 			fmt.Printf("  Hashing %s\n", relPath)
 		}
 	}
@@ -211,124 +387,68 @@ func (s *Signer) computeContentHash(dir string) ([]byte, error) {
 	return hash.Sum(nil), nil
 }
 
-func (s *Signer) createSignatureFile(bundleID string, contentHash, signature []byte) string {
-	return fmt.Sprintf(`-----BEGIN RICECAKE SIGNATURE-----
-Version: 1
+// createSignatureFile formats a version 3 signature. The signature covers
+// every header, so the role, key fingerprint and scope cannot be altered.
+// An empty scope signs the checksum index; ScopeArchive signs the archive
+// file itself.
+func (s *Signer) createSignatureFile(bundleID, scope string, contentHash []byte) (string, error) {
+	var validity string
+	if scope != "" {
+		validity += "\nScope: " + scope
+	}
+	if !s.ValidFrom.IsZero() {
+		validity += "\nKey-Valid-From: " + s.ValidFrom.UTC().Format(time.RFC3339)
+	}
+	if !s.ValidUntil.IsZero() {
+		validity += "\nKey-Valid-Until: " + s.ValidUntil.UTC().Format(time.RFC3339)
+	}
+
+	headerText := fmt.Sprintf(`Version: 3
 Bundle-ID: %s
 Created-At: %s
 Tool-Version: rice-cli v1.0.0
+Key-Fingerprint: %s
+Role: %s%s
 Hash-Algorithm: SHA-256
-Content-Hash: %s
-
-%s
------END RICECAKE SIGNATURE-----
-`,
+Content-Hash: %s`,
 		bundleID,
 		time.Now().UTC().Format(time.RFC3339),
+		Fingerprint(s.publicKey()),
+		s.Role,
+		validity,
 		base64.StdEncoding.EncodeToString(contentHash),
-		base64.StdEncoding.EncodeToString(signature),
 	)
-}
 
-func extractBundle(bundlePath, destDir string) error {
-	reader, err := zip.OpenReader(bundlePath)
+	// Ed25519 signs the message itself rather than a digest of it
+	message := []byte(signedPrefix + headerText + "\n")
+	signature, err := s.key.Sign(rand.Reader, message, crypto.Hash(0))
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to sign: %w", err)
 	}
-	defer reader.Close()
-
-	for _, file := range reader.File {
-		destPath := filepath.Join(destDir, file.Name)
-
-		// Security check
-		if !strings.HasPrefix(destPath, filepath.Clean(destDir)+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid file path: %s", file.Name)
-		}
-
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(destPath, 0755)
-			continue
-		}
 
-		// Create parent directories
-		os.MkdirAll(filepath.Dir(destPath), 0755)
-
-		// Extract file
-		srcFile, err := file.Open()
-		if err != nil {
-			return err
-		}
-
-		destFile, err := os.Create(destPath)
-		if err != nil {
-			srcFile.Close()
-			return err
-		}
-
-		_, err = io.Copy(destFile, srcFile)
-		srcFile.Close()
-		destFile.Close()
-		if err != nil {
-			return err
-		}
+	// External signers could hold a different key than they claim
+	if !ed25519.Verify(s.publicKey(), message, signature) {
+		return "", fmt.Errorf("signer returned an invalid signature for %s", Fingerprint(s.publicKey()))
 	}
 
-	return nil
-}
-
-func rebuildBundle(sourceDir, destPath string) error {
-	outFile, err := os.Create(destPath)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
-
-	zipWriter := zip.NewWriter(outFile)
-	defer zipWriter.Close()
-
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relPath, err := filepath.Rel(sourceDir, path)
-		if err != nil {
-			return err
-		}
-
-		if relPath == "." {
-			return nil
-		}
-
-		// Convert to forward slashes
-		zipPath := strings.ReplaceAll(relPath, string(filepath.Separator), "/")
-
-		if info.IsDir() {
-			_, err = zipWriter.Create(zipPath + "/")
-			return err
-		}
-
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-		header.Name = zipPath
-		header.Method = zip.Deflate
-
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
-		}
+	content := fmt.Sprintf("%s\n%s\n\n%s\n%s\n",
+		signatureBegin,
+		headerText,
+		base64.StdEncoding.EncodeToString(signature),
+		signatureEnd,
+	)
 
-		file, err := os.Open(path)
+	// The token covers the signature value, proving when it existed
+	if s.Timestamper != nil {
+		imprint := sha256.Sum256(signature)
+		token, err := s.Timestamper.Timestamp(imprint[:])
 		if err != nil {
-			return err
+			return "", fmt.Errorf("failed to timestamp signature: %w", err)
 		}
-		defer file.Close()
+		content += string(token)
+	}
 
-		_, err = io.Copy(writer, file)
-		return err
-	})
+	return content, nil
 }
 
 // GenerateKeyPair generates a new Ed25519 key pair
@@ -336,25 +456,43 @@ func GenerateKeyPair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
 	return ed25519.GenerateKey(rand.Reader)
 }
 
-// SaveKeyPair saves a key pair to files
-func SaveKeyPair(publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey, outputDir string) error {
-	// Save private key
-	privateBlock := &pem.Block{
+// EncodePrivateKey returns the PEM encoding of a private key
+func EncodePrivateKey(privateKey ed25519.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
 		Type:  "ED25519 PRIVATE KEY",
 		Bytes: privateKey,
+	})
+}
+
+// EncodePublicKey returns the PEM encoding of a public key
+func EncodePublicKey(publicKey ed25519.PublicKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "ED25519 PUBLIC KEY",
+		Bytes: publicKey,
+	})
+}
+
+// SaveKeyPair saves a key pair to files in format. The private key is
+// encrypted if passphrase is not empty.
+func SaveKeyPair(publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey, outputDir, format string, passphrase []byte) error {
+	privateData, err := MarshalPrivateKey(privateKey, format, passphrase)
+	if err != nil {
+		return err
 	}
+	publicData, err := MarshalPublicKey(publicKey, format)
+	if err != nil {
+		return err
+	}
+
+	// Save private key
 	privatePath := filepath.Join(outputDir, "private.key")
-	if err := os.WriteFile(privatePath, pem.EncodeToMemory(privateBlock), 0600); err != nil {
+	if err := os.WriteFile(privatePath, privateData, 0600); err != nil {
 		return fmt.Errorf("failed to save private key: %w", err)
 	}
 
 	// Save public key
-	publicBlock := &pem.Block{
-		Type:  "ED25519 PUBLIC KEY",
-		Bytes: publicKey,
-	}
 	publicPath := filepath.Join(outputDir, "public.key")
-	if err := os.WriteFile(publicPath, pem.EncodeToMemory(publicBlock), 0644); err != nil {
+	if err := os.WriteFile(publicPath, publicData, 0644); err != nil {
 		return fmt.Errorf("failed to save public key: %w", err)
 	}
 
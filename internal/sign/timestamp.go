@@ -0,0 +1,173 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	timestampBegin = "-----BEGIN RICECAKE TIMESTAMP-----"
+	timestampEnd   = "-----END RICECAKE TIMESTAMP-----"
+
+	// timestampPrefix starts the message a timestamp authority signs
+	timestampPrefix = "RICECAKE TIMESTAMP v1\n"
+
+	// localPolicy identifies tokens issued by a LocalAuthority
+	localPolicy = "rice-local-tsa"
+)
+
+// Timestamper issues timestamp tokens, in the manner of an RFC 3161
+// time-stamping authority: a signed statement that a digest existed at a
+// given time. Signing asks for a token over the SHA-256 of the signature
+// value, which proves when the signature was made.
+type Timestamper interface {
+	Timestamp(imprint []byte) ([]byte, error)
+}
+
+// TimestampToken is a parsed timestamp token
+type TimestampToken struct {
+	Policy         string
+	HashAlgorithm  string
+	MessageImprint []byte
+	SerialNumber   string
+	GenTime        time.Time
+	TSAFingerprint string
+	Signature      []byte
+
+	headerText string
+}
+
+// LocalAuthority is a stand-in time-stamping authority that signs tokens
+// with a local Ed25519 key, for testing and for setups without an RFC 3161
+// service. Its tokens are only as trustworthy as the machine holding the
+// key and its clock.
+type LocalAuthority struct {
+	key crypto.Signer
+	now func() time.Time
+}
+
+// NewLocalAuthority creates an authority that signs with key
+func NewLocalAuthority(key crypto.Signer) (*LocalAuthority, error) {
+	if _, ok := key.Public().(ed25519.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported key type %T: timestamps are signed with Ed25519 keys", key.Public())
+	}
+	return &LocalAuthority{key: key, now: time.Now}, nil
+}
+
+// Timestamp issues a token stating that imprint, a SHA-256 digest, existed
+// now
+func (a *LocalAuthority) Timestamp(imprint []byte) ([]byte, error) {
+	if len(imprint) != 32 {
+		return nil, fmt.Errorf("timestamp imprint must be a SHA-256 digest")
+	}
+
+	serial := make([]byte, 16)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	headerText := fmt.Sprintf(`Version: 1
+Policy: %s
+Hash-Algorithm: SHA-256
+Message-Imprint: %s
+Serial-Number: %s
+Gen-Time: %s
+TSA-Fingerprint: %s`,
+		localPolicy,
+		base64.StdEncoding.EncodeToString(imprint),
+		hex.EncodeToString(serial),
+		a.now().UTC().Format(time.RFC3339),
+		Fingerprint(a.key.Public().(ed25519.PublicKey)),
+	)
+
+	signature, err := a.key.Sign(rand.Reader, []byte(timestampPrefix+headerText+"\n"), crypto.Hash(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign timestamp: %w", err)
+	}
+
+	return []byte(fmt.Sprintf("%s\n%s\n\n%s\n%s\n",
+		timestampBegin,
+		headerText,
+		base64.StdEncoding.EncodeToString(signature),
+		timestampEnd,
+	)), nil
+}
+
+// ParseTimestampToken parses a timestamp token block
+func ParseTimestampToken(data []byte) (*TimestampToken, error) {
+	text := strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	if !strings.HasPrefix(text, timestampBegin) || !strings.HasSuffix(text, timestampEnd) {
+		return nil, fmt.Errorf("%w: missing timestamp block markers", ErrMalformed)
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(text, timestampBegin), timestampEnd)
+	headerText, sigText, found := strings.Cut(strings.Trim(body, "\n"), "\n\n")
+	if !found {
+		return nil, fmt.Errorf("%w: missing timestamp signature", ErrMalformed)
+	}
+
+	headers := make(map[string]string)
+	for _, line := range strings.Split(headerText, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid timestamp header line %q", ErrMalformed, line)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if headers["Version"] != "1" {
+		return nil, fmt.Errorf("%w: unsupported timestamp version %q", ErrMalformed, headers["Version"])
+	}
+
+	token := &TimestampToken{
+		Policy:         headers["Policy"],
+		HashAlgorithm:  headers["Hash-Algorithm"],
+		SerialNumber:   headers["Serial-Number"],
+		TSAFingerprint: headers["TSA-Fingerprint"],
+		headerText:     headerText,
+	}
+	if token.HashAlgorithm != "SHA-256" {
+		return nil, fmt.Errorf("%w: unsupported timestamp hash algorithm %q", ErrMalformed, token.HashAlgorithm)
+	}
+
+	imprint, err := base64.StdEncoding.DecodeString(headers["Message-Imprint"])
+	if err != nil || len(imprint) != 32 {
+		return nil, fmt.Errorf("%w: invalid Message-Imprint", ErrMalformed)
+	}
+	token.MessageImprint = imprint
+
+	if token.GenTime, err = time.Parse(time.RFC3339, headers["Gen-Time"]); err != nil {
+		return nil, fmt.Errorf("%w: invalid Gen-Time: %v", ErrMalformed, err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(sigText), ""))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: invalid timestamp signature", ErrMalformed)
+	}
+	token.Signature = signature
+
+	return token, nil
+}
+
+// Verify checks that the token covers imprint and was signed by one of
+// authorities. It returns ErrWrongKey if no authority issued it.
+func (t *TimestampToken) Verify(imprint []byte, authorities []ed25519.PublicKey) error {
+	for _, key := range authorities {
+		if Fingerprint(key) != t.TSAFingerprint {
+			continue
+		}
+		if !ed25519.Verify(key, []byte(timestampPrefix+t.headerText+"\n"), t.Signature) {
+			return fmt.Errorf("%w: timestamp token was altered", ErrTampered)
+		}
+		if !bytes.Equal(t.MessageImprint, imprint) {
+			return fmt.Errorf("%w: timestamp token is for a different signature", ErrTampered)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: timestamp issued by %s", ErrWrongKey, t.TSAFingerprint)
+}
@@ -0,0 +1,94 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Trust is what verification accepts: the trusted signing keys, the
+// period in which each key's signatures are accepted, and the timestamp
+// authorities whose tokens are believed
+type Trust struct {
+	Keys         []ed25519.PublicKey
+	Policies     map[string]KeyPolicy // by key fingerprint
+	Timestampers []ed25519.PublicKey
+}
+
+// KeyPolicy limits when signatures made by a key are accepted. Zero times
+// are unbounded. Signatures are judged by when they were made, not when
+// they are verified, so a signature made before a key expired or was
+// revoked stays valid. Only a trusted timestamp proves when that was: a
+// signature without one is treated as made no earlier than its
+// verification.
+type KeyPolicy struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+	RevokedAt time.Time // signatures made at or after this time are rejected
+}
+
+// TrustKeys returns a Trust accepting keys without time limits
+func TrustKeys(keys ...ed25519.PublicKey) *Trust {
+	return &Trust{Keys: keys}
+}
+
+// signingTime returns when sig was made: the time of a timestamp token
+// from a trusted authority if it has one, otherwise the signer's own
+// Created-At. A token from an unknown authority is ignored.
+func (t *Trust) signingTime(sig *Signature) (time.Time, bool, error) {
+	if sig.Timestamp != nil {
+		imprint := sha256.Sum256(sig.Signature)
+		err := sig.Timestamp.Verify(imprint[:], t.Timestampers)
+		if err == nil {
+			return sig.Timestamp.GenTime, true, nil
+		}
+		if !errors.Is(err, ErrWrongKey) {
+			return sig.CreatedAt, false, err
+		}
+	}
+	return sig.CreatedAt, false, nil
+}
+
+// checkTime checks that sig was made while key was valid, both as the
+// signature itself declares and as the key's policy allows. Unless
+// timestamped, signedAt is the signer's claim and anyone holding the key
+// can backdate it, so the end of the validity period and the revocation
+// are checked against the verification time as well.
+func (t *Trust) checkTime(sig *Signature, key ed25519.PublicKey, signedAt time.Time, timestamped bool) error {
+	policy := t.Policies[Fingerprint(key)]
+	limited := !sig.KeyValidFrom.IsZero() || !sig.KeyValidUntil.IsZero() ||
+		policy != (KeyPolicy{})
+	if !limited {
+		return nil
+	}
+	if signedAt.IsZero() {
+		return fmt.Errorf("%w: signature has no signing time", ErrKeyExpired)
+	}
+
+	notBefore, notAfter := sig.KeyValidFrom, sig.KeyValidUntil
+	if !policy.NotBefore.IsZero() && policy.NotBefore.After(notBefore) {
+		notBefore = policy.NotBefore
+	}
+	if !policy.NotAfter.IsZero() && (notAfter.IsZero() || policy.NotAfter.Before(notAfter)) {
+		notAfter = policy.NotAfter
+	}
+
+	stamp := signedAt.Format(time.RFC3339)
+	if !notBefore.IsZero() && signedAt.Before(notBefore) {
+		return fmt.Errorf("%w: signed %s, key valid from %s", ErrKeyExpired, stamp, notBefore.Format(time.RFC3339))
+	}
+
+	latest := signedAt
+	if now := time.Now(); !timestamped && now.After(latest) {
+		latest, stamp = now, "without a trusted timestamp"
+	}
+	if !notAfter.IsZero() && latest.After(notAfter) {
+		return fmt.Errorf("%w: signed %s, key expired %s", ErrKeyExpired, stamp, notAfter.Format(time.RFC3339))
+	}
+	if !policy.RevokedAt.IsZero() && !latest.Before(policy.RevokedAt) {
+		return fmt.Errorf("%w: signed %s, key revoked %s", ErrKeyRevoked, stamp, policy.RevokedAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedSource writes a minimal bundle source directory signed by key and
+// returns its path and the signature file path
+func signedSource(t *testing.T, key ed25519.PrivateKey, tsa Timestamper) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"manifest.yaml":         "bundle:\n  bundle_id: 0b0e6f3e-6a4c-4d7e-9a51-2f3c1d4e5f60\n",
+		"liner-notes/notes.txt": "Recorded live.\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signer := NewSigner(key, false)
+	signer.Timestamper = tsa
+	if err := signer.SignDirectory(dir); err != nil {
+		t.Fatalf("SignDirectory: %v", err)
+	}
+	return dir, filepath.Join(dir, filepath.FromSlash(signer.SignatureName()))
+}
+
+// backdate rewrites the Created-At of the signature at path and re-signs
+// it with key, as anyone holding the key can
+func backdate(t *testing.T, path string, key ed25519.PrivateKey, at time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ParseSignature(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(sig.headerText, "\n") {
+		if strings.HasPrefix(line, "Created-At:") {
+			line = "Created-At: " + at.UTC().Format(time.RFC3339)
+		}
+		lines = append(lines, line)
+	}
+	headerText := strings.Join(lines, "\n")
+	value := ed25519.Sign(key, []byte(signedPrefix+headerText+"\n"))
+
+	content := signatureBegin + "\n" + headerText + "\n\n" +
+		base64.StdEncoding.EncodeToString(value) + "\n" + signatureEnd + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackdatedSignature(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	revokedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		policy KeyPolicy
+		want   error
+	}{
+		{"revoked", KeyPolicy{RevokedAt: revokedAt}, ErrKeyRevoked},
+		{"expired", KeyPolicy{NotAfter: revokedAt}, ErrKeyExpired},
+		{"revocation pending", KeyPolicy{RevokedAt: time.Now().Add(time.Hour)}, nil},
+		{"unlimited", KeyPolicy{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, sigPath := signedSource(t, priv, nil)
+			backdate(t, sigPath, priv, past)
+
+			trust := &Trust{
+				Keys:     []ed25519.PublicKey{pub},
+				Policies: map[string]KeyPolicy{Fingerprint(pub): tt.policy},
+			}
+			results, err := VerifyAllFS(os.DirFS(dir), trust)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			if got := results[0].Err; !errors.Is(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampedBeforeRevocation(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsaPub, tsaPriv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedAt := time.Now().Add(-2 * time.Hour)
+	tsa := &LocalAuthority{key: tsaPriv, now: func() time.Time { return signedAt }}
+	dir, _ := signedSource(t, priv, tsa)
+
+	policy := KeyPolicy{RevokedAt: time.Now().Add(-time.Hour)}
+	trust := &Trust{
+		Keys:     []ed25519.PublicKey{pub},
+		Policies: map[string]KeyPolicy{Fingerprint(pub): policy},
+	}
+
+	results, err := VerifyAllFS(os.DirFS(dir), trust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(results[0].Err, ErrKeyRevoked) {
+		t.Errorf("untrusted timestamp: got %v, want %v", results[0].Err, ErrKeyRevoked)
+	}
+
+	trust.Timestampers = []ed25519.PublicKey{tsaPub}
+	results, err = VerifyAllFS(os.DirFS(dir), trust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || !results[0].Timestamped {
+		t.Errorf("trusted timestamp: got %v (timestamped %v), want valid", results[0].Err, results[0].Timestamped)
+	}
+}
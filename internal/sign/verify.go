@@ -0,0 +1,516 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+	"gopkg.in/yaml.v3"
+)
+
+// Verification failures, distinguishable with errors.Is
+var (
+	ErrUnsigned  = errors.New("bundle is not signed")
+	ErrMalformed = errors.New("signature is malformed")
+	ErrTampered  = errors.New("bundle contents do not match signature")
+	ErrWrongKey  = errors.New("signature was not made with this key")
+
+	// ErrKeyRevoked and ErrKeyExpired report signatures made with a
+	// trusted key at a time the key was not valid
+	ErrKeyRevoked = errors.New("signature was made after the key was revoked")
+	ErrKeyExpired = errors.New("signature was made outside the key's validity period")
+)
+
+const (
+	signatureBegin = "-----BEGIN RICECAKE SIGNATURE-----"
+	signatureEnd   = "-----END RICECAKE SIGNATURE-----"
+)
+
+// TamperedError lists the files that no longer match a signed checksum
+// index. It matches ErrTampered with errors.Is.
+type TamperedError struct {
+	Missing  []string
+	Extra    []string
+	Modified []string
+}
+
+func (e *TamperedError) Error() string {
+	var parts []string
+	if n := len(e.Modified); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d modified", n))
+	}
+	if n := len(e.Missing); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d missing", n))
+	}
+	if n := len(e.Extra); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d extra", n))
+	}
+	return fmt.Sprintf("%v: %s file(s)", ErrTampered, strings.Join(parts, ", "))
+}
+
+// Is reports whether target is ErrTampered
+func (e *TamperedError) Is(target error) bool {
+	return target == ErrTampered
+}
+
+// signedPrefix starts the message signed by version 3 signatures, which
+// cover the whole header block rather than only the content hash
+const signedPrefix = "RICECAKE SIGNATURE v3\n"
+
+// Signature is a parsed signature file
+type Signature struct {
+	Version        string
+	BundleID       string
+	CreatedAt      time.Time
+	ToolVersion    string
+	KeyFingerprint string // version 3 and later
+	Role           string // version 3 and later
+	Scope          string // ScopeArchive for detached signatures
+	HashAlgorithm  string
+	ContentHash    []byte
+	Signature      []byte
+
+	// KeyValidFrom and KeyValidUntil are the validity period the signer
+	// declared for its key, if any (version 3 and later)
+	KeyValidFrom  time.Time
+	KeyValidUntil time.Time
+
+	// Timestamp is a token proving when the signature was made, if any
+	Timestamp *TimestampToken
+
+	headerText string
+}
+
+// ParseSignature parses the contents of a signature file
+func ParseSignature(data []byte) (*Signature, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimSpace(text)
+
+	// A timestamp token may follow the signature block
+	text, tokenText, hasToken := strings.Cut(text, timestampBegin)
+	text = strings.TrimSpace(text)
+
+	if !strings.HasPrefix(text, signatureBegin) || !strings.HasSuffix(text, signatureEnd) {
+		return nil, fmt.Errorf("%w: missing signature block markers", ErrMalformed)
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(text, signatureBegin), signatureEnd)
+	body = strings.Trim(body, "\n")
+
+	// Headers and signature are separated by a blank line
+	headerText, sigText, found := strings.Cut(body, "\n\n")
+	if !found {
+		return nil, fmt.Errorf("%w: missing signature value", ErrMalformed)
+	}
+
+	headers := make(map[string]string)
+	for _, line := range strings.Split(headerText, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid header line %q", ErrMalformed, line)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	sig := &Signature{
+		Version:        headers["Version"],
+		BundleID:       headers["Bundle-ID"],
+		ToolVersion:    headers["Tool-Version"],
+		KeyFingerprint: headers["Key-Fingerprint"],
+		Role:           headers["Role"],
+		Scope:          headers["Scope"],
+		HashAlgorithm:  headers["Hash-Algorithm"],
+		headerText:     headerText,
+	}
+
+	switch sig.Version {
+	case "1":
+	case "3":
+		if !strings.HasPrefix(sig.KeyFingerprint, "SHA256:") {
+			return nil, fmt.Errorf("%w: invalid Key-Fingerprint", ErrMalformed)
+		}
+		if err := ValidateRole(sig.Role); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		if sig.Scope != "" && sig.Scope != ScopeArchive {
+			return nil, fmt.Errorf("%w: unsupported scope %q", ErrMalformed, sig.Scope)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrMalformed, sig.Version)
+	}
+	if sig.HashAlgorithm != "SHA-256" {
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %q", ErrMalformed, sig.HashAlgorithm)
+	}
+
+	for header, field := range map[string]*time.Time{
+		"Created-At":      &sig.CreatedAt,
+		"Key-Valid-From":  &sig.KeyValidFrom,
+		"Key-Valid-Until": &sig.KeyValidUntil,
+	} {
+		if value := headers[header]; value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid %s: %v", ErrMalformed, header, err)
+			}
+			*field = t
+		}
+	}
+
+	if hasToken {
+		token, err := ParseTimestampToken([]byte(timestampBegin + tokenText))
+		if err != nil {
+			return nil, err
+		}
+		sig.Timestamp = token
+	}
+
+	contentHash, err := base64.StdEncoding.DecodeString(headers["Content-Hash"])
+	if err != nil || len(contentHash) != 32 {
+		return nil, fmt.Errorf("%w: invalid Content-Hash", ErrMalformed)
+	}
+	sig.ContentHash = contentHash
+
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(sigText), ""))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: invalid signature value", ErrMalformed)
+	}
+	sig.Signature = signature
+
+	return sig, nil
+}
+
+// IsSignature reports whether data parses as a signature file
+func IsSignature(data []byte) bool {
+	_, err := ParseSignature(data)
+	return err == nil
+}
+
+// signedMessage returns the bytes the signature value was computed over
+func (s *Signature) signedMessage() []byte {
+	if s.Version == "1" {
+		return s.ContentHash
+	}
+	return []byte(signedPrefix + s.headerText + "\n")
+}
+
+// LoadPublicKey loads an Ed25519 public key from a file
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return ParsePublicKey(data)
+}
+
+// Verify checks the signatures of a .ricecake bundle or source directory
+// against the trusted keys
+func Verify(bundlePath string, trusted ...ed25519.PublicKey) (*Signature, error) {
+	results, err := VerifyAll(bundlePath, TrustKeys(trusted...))
+	if err != nil {
+		return nil, err
+	}
+	return Outcome(results, trusted...)
+}
+
+// VerifyAll checks every signature of a .ricecake bundle or source
+// directory. For an archive, the signatures in its detached signature
+// file are checked too.
+func VerifyAll(bundlePath string, trust *Trust) ([]Result, error) {
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat bundle: %w", err)
+	}
+
+	if info.IsDir() {
+		return VerifyAllFS(os.DirFS(bundlePath), trust)
+	}
+
+	reader, err := bundle.OpenArchive(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return VerifyArchive(reader, bundlePath, trust)
+}
+
+// VerifyFS checks the signatures in fsys against the trusted keys,
+// returning a valid signature. If none is valid, the most relevant failure
+// is returned.
+func VerifyFS(fsys fs.FS, trusted ...ed25519.PublicKey) (*Signature, error) {
+	results, err := VerifyAllFS(fsys, TrustKeys(trusted...))
+	if err != nil {
+		return nil, err
+	}
+	return Outcome(results, trusted...)
+}
+
+// Result is the outcome of checking one signature file
+type Result struct {
+	File      string
+	Signature *Signature // nil if the file could not be read or parsed
+	Err       error      // nil if the signature is valid for a trusted key
+
+	// SignedAt is when the signature was made, taken from a trusted
+	// timestamp token if Timestamped, otherwise from the signer's clock
+	SignedAt    time.Time
+	Timestamped bool
+}
+
+// Outcome reduces results to the first valid signature. Otherwise it
+// reports the failure of a signature made by a trusted key, then any
+// content failure, then the first failure, so tampering is reported ahead
+// of a wrong key.
+func Outcome(results []Result, trusted ...ed25519.PublicKey) (*Signature, error) {
+	for _, r := range results {
+		if r.Err == nil {
+			return r.Signature, nil
+		}
+	}
+
+	fingerprints := make(map[string]bool, len(trusted))
+	for _, key := range trusted {
+		fingerprints[Fingerprint(key)] = true
+	}
+	for _, r := range results {
+		if r.Signature != nil && fingerprints[r.Signature.KeyFingerprint] {
+			return r.Signature, r.Err
+		}
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, ErrWrongKey) {
+			return r.Signature, r.Err
+		}
+	}
+	return results[0].Signature, results[0].Err
+}
+
+// SignatureFiles lists the signature files in fsys: signature.sig from
+// earlier versions, then signatures/*.sig in name order
+func SignatureFiles(fsys fs.FS) ([]string, error) {
+	var files []string
+	if _, err := fs.Stat(fsys, bundle.SignatureFile); err == nil {
+		files = append(files, bundle.SignatureFile)
+	}
+
+	entries, err := fs.ReadDir(fsys, bundle.SignaturesDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list signatures: %w", err)
+	}
+	for _, entry := range entries {
+		name := path.Join(bundle.SignaturesDir, entry.Name())
+		if !entry.IsDir() && bundle.IsSignatureFile(name) {
+			files = append(files, name)
+		}
+	}
+
+	return files, nil
+}
+
+// VerifyAllFS checks every signature in fsys against trust
+func VerifyAllFS(fsys fs.FS, trust *Trust) ([]Result, error) {
+	files, err := SignatureFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrUnsigned
+	}
+
+	v := &verifier{fsys: fsys, trust: trust}
+	results := make([]Result, 0, len(files))
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			results = append(results, Result{File: name, Err: fmt.Errorf("failed to read signature: %w", err)})
+			continue
+		}
+		results = append(results, v.checkData(name, data))
+	}
+
+	return results, nil
+}
+
+// verifier checks signatures of one bundle, computing the content checks
+// shared between signatures only once
+type verifier struct {
+	fsys  fs.FS
+	trust *Trust
+
+	// archiveHash is the SHA-256 of the archive file when checking
+	// detached signatures, which sign the archive rather than the index
+	archiveHash []byte
+
+	// Set on first use; bundleID is nil until the manifest has been read
+	bundleID    *string
+	bundleIDErr error
+	legacyHash  []byte
+	legacyErr   error
+	diff        *bundle.ChecksumDiff
+	diffErr     error
+}
+
+// checkData parses and checks the signature data read from name
+func (v *verifier) checkData(name string, data []byte) Result {
+	result := Result{File: name}
+	if result.Signature, result.Err = ParseSignature(data); result.Err == nil {
+		result.Err = v.check(&result)
+	}
+	return result
+}
+
+// check verifies the signature in r and records when it was made
+func (v *verifier) check(r *Result) error {
+	key, err := v.verify(r.Signature)
+
+	signedAt, timestamped, timeErr := v.trust.signingTime(r.Signature)
+	r.SignedAt, r.Timestamped = signedAt, timestamped
+	if err != nil {
+		return err
+	}
+	if timeErr != nil {
+		return timeErr
+	}
+	return v.trust.checkTime(r.Signature, key, signedAt, timestamped)
+}
+
+// verify checks the signature and the bundle contents, returning the
+// trusted key that made it
+func (v *verifier) verify(sig *Signature) (ed25519.PublicKey, error) {
+	// Bundle-ID must match the manifest (version 1 does not sign it)
+	if v.bundleID == nil {
+		bundleID, err := readBundleID(v.fsys)
+		v.bundleID, v.bundleIDErr = &bundleID, err
+	}
+	if v.bundleIDErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTampered, v.bundleIDErr)
+	}
+	if *v.bundleID != sig.BundleID {
+		return nil, fmt.Errorf("%w: Bundle-ID %s does not match manifest bundle_id %s",
+			ErrTampered, sig.BundleID, *v.bundleID)
+	}
+
+	// Detached signatures cover the archive file byte for byte; a scope
+	// that does not match where the signature was found is rejected, so
+	// one kind cannot be passed off as the other
+	if (sig.Scope == ScopeArchive) != (v.archiveHash != nil) {
+		if v.archiveHash != nil {
+			return nil, fmt.Errorf("%w: detached signature does not cover the archive", ErrMalformed)
+		}
+		return nil, fmt.Errorf("%w: archive signature is not detached", ErrMalformed)
+	}
+	if sig.Scope == ScopeArchive {
+		if !bytes.Equal(v.archiveHash, sig.ContentHash) {
+			return nil, fmt.Errorf("%w: archive was modified after it was signed", ErrTampered)
+		}
+		return v.verifyKey(sig)
+	}
+
+	if sig.Version == "1" {
+		// Version 1 signs a single hash over every file
+		if v.legacyHash == nil && v.legacyErr == nil {
+			v.legacyHash, v.legacyErr = computeContentHash(v.fsys, false)
+		}
+		if v.legacyErr != nil {
+			return nil, fmt.Errorf("failed to compute content hash: %w", v.legacyErr)
+		}
+		if !bytes.Equal(v.legacyHash, sig.ContentHash) {
+			return nil, ErrTampered
+		}
+		return v.verifyKey(sig)
+	}
+
+	// Version 3 signs checksums.yaml, which is then checked file by file
+	index, err := fs.ReadFile(v.fsys, bundle.ChecksumsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s: %v", ErrTampered, bundle.ChecksumsFile, err)
+	}
+	contentHash := sha256.Sum256(index)
+	if !bytes.Equal(contentHash[:], sig.ContentHash) {
+		return nil, fmt.Errorf("%w: %s was modified", ErrTampered, bundle.ChecksumsFile)
+	}
+
+	key, err := v.verifyKey(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.diff == nil && v.diffErr == nil {
+		v.diff, v.diffErr = compareChecksums(v.fsys, index)
+	}
+	if v.diffErr != nil {
+		return nil, v.diffErr
+	}
+	if !v.diff.Empty() {
+		return nil, &TamperedError{Missing: v.diff.Missing, Extra: v.diff.Extra, Modified: v.diff.Modified}
+	}
+
+	return key, nil
+}
+
+// compareChecksums checks the files in fsys against the checksums.yaml
+// index
+func compareChecksums(fsys fs.FS, index []byte) (*bundle.ChecksumDiff, error) {
+	checksums, err := bundle.ParseChecksums(index)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	diff, err := checksums.Compare(fsys, IsSignature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check files: %w", err)
+	}
+	return diff, nil
+}
+
+// verifyKey checks the signature value against the trusted keys,
+// returning the key that made it. Version 3 signatures name their key, so
+// only a key with that fingerprint is tried.
+func (v *verifier) verifyKey(sig *Signature) (ed25519.PublicKey, error) {
+	message := sig.signedMessage()
+	named := false
+	for _, key := range v.trust.Keys {
+		if sig.KeyFingerprint != "" {
+			if Fingerprint(key) != sig.KeyFingerprint {
+				continue
+			}
+			named = true
+		}
+		if ed25519.Verify(key, message, sig.Signature) {
+			return key, nil
+		}
+	}
+
+	// The named key is trusted but did not sign these headers
+	if named {
+		return nil, fmt.Errorf("%w: signature headers were altered", ErrTampered)
+	}
+	if sig.KeyFingerprint != "" {
+		return nil, fmt.Errorf("%w: signed by %s", ErrWrongKey, sig.KeyFingerprint)
+	}
+	return nil, ErrWrongKey
+}
+
+// readBundleID returns bundle.bundle_id from manifest.yaml
+func readBundleID(fsys fs.FS) (string, error) {
+	manifestData, err := fs.ReadFile(fsys, "manifest.yaml")
+	if err != nil {
+		return "", fmt.Errorf("cannot read manifest: %v", err)
+	}
+	var manifest struct {
+		Bundle struct {
+			BundleID string `yaml:"bundle_id"`
+		} `yaml:"bundle"`
+	}
+	if err := yaml.Unmarshal(manifestData, &manifest); err != nil {
+		return "", fmt.Errorf("cannot parse manifest: %v", err)
+	}
+	return manifest.Bundle.BundleID, nil
+}
@@ -0,0 +1,141 @@
+package validate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+	"github.com/davesmith10/rice-cli/internal/sign"
+	"github.com/davesmith10/rice-cli/pkg/ricecake"
+)
+
+// topLevelFiles lists the files allowed at the root of a bundle archive
+var topLevelFiles = map[string]bool{
+	"manifest.yaml":  true,
+	"copyright.txt":  true,
+	"checksums.yaml": true,
+	"signature.sig":  true,
+}
+
+// topLevelDirs lists the directories allowed at the root of a bundle archive
+var topLevelDirs = map[string]bool{
+	"audio":       true,
+	"images":      true,
+	"liner-notes": true,
+	"signatures":  true,
+}
+
+// validateArchive runs checks that only apply to built .ricecake archives,
+// looking at the raw ZIP entries rather than the filesystem view of them
+func (v *Validator) validateArchive() {
+	seen := make(map[string]bool)
+	var dirEntries []string
+	fileDirs := make(map[string]bool)
+	failed := false
+
+	for _, file := range v.archive.File {
+		name := file.Name
+
+		// Check for unsafe entry names
+		if err := bundle.CheckEntryName(name); err != nil {
+			v.addResult("Archive", fmt.Sprintf("entry %s", name), false, "error", err.Error())
+			failed = true
+			continue
+		}
+
+		isDir := strings.HasSuffix(name, "/")
+		clean := strings.TrimSuffix(name, "/")
+
+		// Check for duplicate entries
+		if seen[clean] {
+			v.addResult("Archive", fmt.Sprintf("entry %s", name), false, "error", "duplicate entry in archive")
+			failed = true
+			continue
+		}
+		seen[clean] = true
+
+		// Check the entry sits inside the expected top-level layout
+		top, _, nested := strings.Cut(clean, "/")
+		if nested || isDir {
+			if !topLevelDirs[top] {
+				v.addResult("Archive", fmt.Sprintf("entry %s", name), false, "error",
+					fmt.Sprintf("directory %s/ is not part of the bundle layout", top))
+				failed = true
+				continue
+			}
+		} else if !topLevelFiles[top] {
+			v.addResult("Archive", fmt.Sprintf("entry %s", name), false, "error",
+				"file is not part of the bundle layout")
+			failed = true
+			continue
+		}
+
+		if isDir {
+			dirEntries = append(dirEntries, clean)
+			continue
+		}
+
+		// Remember every directory that contains a file
+		for dir := path.Dir(clean); dir != "."; dir = path.Dir(dir) {
+			fileDirs[dir] = true
+		}
+	}
+
+	// Check for directory entries that contain no files
+	for _, dir := range dirEntries {
+		if !fileDirs[dir] {
+			v.addResult("Archive", fmt.Sprintf("entry %s/", dir), false, "warning", "directory entry contains no files")
+			failed = true
+		}
+	}
+
+	if !failed {
+		v.addResult("Archive", "archive entries", true, "", "")
+	}
+}
+
+// validateIntegrity decompresses every archive entry so corrupt data is
+// reported before the bundle ships
+func (v *Validator) validateIntegrity(b *ricecake.Bundle) {
+	if err := b.CheckArchive(); err != nil {
+		v.addResult("Archive", "archive integrity", false, "error", err.Error())
+		return
+	}
+	v.addResult("Archive", "archive integrity", true, "", "")
+
+	v.validateChecksums()
+}
+
+// validateChecksums compares the files against checksums.yaml, if present
+func (v *Validator) validateChecksums() {
+	data, err := fs.ReadFile(v.fsys, bundle.ChecksumsFile)
+	if err != nil {
+		return // Bundles built before the index existed have none
+	}
+
+	checksums, err := bundle.ParseChecksums(data)
+	if err != nil {
+		v.addResult("Archive", "checksums", false, "error", err.Error())
+		return
+	}
+	diff, err := checksums.Compare(v.fsys, sign.IsSignature)
+	if err != nil {
+		v.addResult("Archive", "checksums", false, "error", fmt.Sprintf("cannot check files: %v", err))
+		return
+	}
+
+	for _, name := range diff.Modified {
+		v.addResult("Archive", fmt.Sprintf("file %s", name), false, "error", "contents do not match checksums.yaml")
+	}
+	for _, name := range diff.Missing {
+		v.addResult("Archive", fmt.Sprintf("file %s", name), false, "error", "listed in checksums.yaml but missing")
+	}
+	for _, name := range diff.Extra {
+		v.addResult("Archive", fmt.Sprintf("file %s", name), false, "error", "not listed in checksums.yaml")
+	}
+	if diff.Empty() {
+		v.addResult("Archive", "checksums", true, "", "")
+	}
+}
@@ -0,0 +1,48 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// validateSize checks the bundle against the file count, total size and
+// text file limits, counting exactly what the builder would include
+func (v *Validator) validateSize() {
+	entries, err := bundle.Contents(v.fsys)
+	if err != nil {
+		v.addResult("Size", "bundle contents", false, "error", fmt.Sprintf("cannot list files: %v", err))
+		return
+	}
+	usage := bundle.MeasureUsage(entries)
+
+	if usage.Entries > manifest.MaxFiles {
+		v.addResult("Size", "file count", false, "error",
+			fmt.Sprintf("%d files and directories exceeds maximum of %d", usage.Entries, manifest.MaxFiles))
+	} else {
+		v.addResult("Size", "file count", true, "", "")
+	}
+
+	if usage.TotalSize > manifest.MaxTotalBundleSize {
+		v.addResult("Size", "total size", false, "error",
+			fmt.Sprintf("%s exceeds maximum of %s (%s)", bundle.FormatSize(usage.TotalSize),
+				bundle.FormatSize(manifest.MaxTotalBundleSize), usage.Breakdown()))
+	} else {
+		v.addResult("Size", "total size", true, "", "")
+	}
+
+	// Audio and image sizes are checked with the rest of their validation
+	for _, entry := range entries {
+		ext := strings.ToLower(path.Ext(entry.Name))
+		if entry.Dir || manifest.AllowedAudioExtensions[ext] || manifest.AllowedImageExtensions[ext] {
+			continue
+		}
+		if entry.Size > manifest.MaxSingleTextFile {
+			v.addResult("Size", fmt.Sprintf("file %s", entry.Name), false, "error",
+				fmt.Sprintf("file exceeds maximum size of %d KB", manifest.MaxSingleTextFile/1024))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/davesmith10/rice-cli/internal/audio"
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// durationTolerance is how far a track's declared duration may differ from
+// the length of its audio files
+const durationTolerance = 2 * time.Second
+
+func (v *Validator) probeAudio(name string, size int64, ext string) (*audio.Info, error) {
+	file, err := v.fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := audio.Probe(file, size, audio.FormatFromExt(ext))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audio stream: %v", err)
+	}
+	return info, nil
+}
+
+// validateStream compares a probed audio file against its audio_formats
+// entry and the duration of the track it belongs to
+func (v *Validator) validateStream(name string, stream *audio.Info) {
+	if v.manifest == nil {
+		return
+	}
+
+	if af := findAudioFormat(v.manifest, stream.Format); af != nil {
+		if af.SampleRate > 0 && af.SampleRate != stream.SampleRate {
+			v.addResult("Audio", fmt.Sprintf("file %s sample rate", name), false, "error",
+				fmt.Sprintf("%s format declares %d Hz but file is %d Hz", af.Format, af.SampleRate, stream.SampleRate))
+		}
+		if af.BitDepth > 0 && stream.BitDepth > 0 && af.BitDepth != stream.BitDepth {
+			v.addResult("Audio", fmt.Sprintf("file %s bit depth", name), false, "error",
+				fmt.Sprintf("%s format declares %d-bit but file is %d-bit", af.Format, af.BitDepth, stream.BitDepth))
+		}
+		// Only constant bitrate streams have an exact bitrate to compare
+		if af.Bitrate > 0 && stream.Format == "mp3" && !stream.VBR && af.Bitrate != stream.Bitrate {
+			v.addResult("Audio", fmt.Sprintf("file %s bitrate", name), false, "error",
+				fmt.Sprintf("%s format declares %d kbps but file is %d kbps", af.Format, af.Bitrate, stream.Bitrate))
+		}
+	}
+
+	track := findTrack(v.manifest, strings.TrimSuffix(name, path.Ext(name)))
+	if track == nil || track.Duration == "" {
+		return
+	}
+
+	declared, err := manifest.ParseDuration(track.Duration)
+	if err != nil {
+		v.addResult("Audio", fmt.Sprintf("file %s duration", name), false, "warning", err.Error())
+		return
+	}
+
+	diff := declared - stream.Duration
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > durationTolerance {
+		v.addResult("Audio", fmt.Sprintf("file %s duration", name), false, "warning",
+			fmt.Sprintf("track %d declares %s but file is %s",
+				track.Number, track.Duration, manifest.FormatDuration(stream.Duration)))
+	}
+}
+
+// findAudioFormat returns the audio_formats entry for format, if any
+func findAudioFormat(m *manifest.Manifest, format string) *manifest.AudioFormat {
+	for i := range m.AudioFormats {
+		if strings.EqualFold(m.AudioFormats[i].Format, format) {
+			return &m.AudioFormats[i]
+		}
+	}
+	return nil
+}
+
+// findTrack returns the track whose filename matches base, if any
+func findTrack(m *manifest.Manifest, base string) *manifest.Track {
+	for i := range m.Tracks {
+		if m.Tracks[i].Filename == base {
+			return &m.Tracks[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package validate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+)
+
+// validateTracks cross-references the manifest track listing against the
+// files in audio/, expecting audio/<filename>.<format> for every track and
+// every entry in audio_formats
+func (v *Validator) validateTracks() {
+	if v.manifest == nil {
+		return // Already reported in manifest check
+	}
+
+	v.validateTrackNumbers()
+
+	entries, err := fs.ReadDir(v.fsys, "audio")
+	if err != nil {
+		return // Already reported in structure check
+	}
+
+	// Collect audio files on disk
+	onDisk := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if manifest.AllowedAudioExtensions[strings.ToLower(path.Ext(entry.Name()))] {
+			onDisk[entry.Name()] = true
+		}
+	}
+
+	// Build the expected track x format matrix
+	expected := make(map[string]bool)
+	trackNames := make(map[string]bool)
+	for _, track := range v.manifest.Tracks {
+		if track.Filename == "" {
+			continue // Already reported in manifest check
+		}
+		trackNames[track.Filename] = true
+
+		complete := true
+		for _, af := range v.manifest.AudioFormats {
+			name := track.Filename + "." + af.Format
+			expected[name] = true
+			if !onDisk[name] {
+				complete = false
+				v.addResult("Tracks", fmt.Sprintf("track %d %s", track.Number, af.Format), false, "error",
+					fmt.Sprintf("audio/%s not found", name))
+			}
+		}
+
+		if complete {
+			v.addResult("Tracks", fmt.Sprintf("track %d files", track.Number), true, "", "")
+		}
+	}
+
+	// Report audio files no track refers to
+	var extra []string
+	for name := range onDisk {
+		if !expected[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	for _, name := range extra {
+		base := strings.TrimSuffix(name, path.Ext(name))
+		if trackNames[base] {
+			v.addResult("Tracks", fmt.Sprintf("file %s", name), false, "warning",
+				fmt.Sprintf("format %s is not listed in audio_formats", strings.TrimPrefix(path.Ext(name), ".")))
+		} else {
+			v.addResult("Tracks", fmt.Sprintf("file %s", name), false, "warning",
+				"audio file is not referenced by any track")
+		}
+	}
+}
+
+// validateTrackNumbers checks that track numbers are unique, within
+// manifest.MaxTracks and run contiguously from 1
+func (v *Validator) validateTrackNumbers() {
+	tracks := v.manifest.Tracks
+
+	if len(tracks) > manifest.MaxTracks {
+		v.addResult("Tracks", "track count", false, "error",
+			fmt.Sprintf("%d tracks exceeds maximum of %d", len(tracks), manifest.MaxTracks))
+	}
+
+	seen := make(map[int]bool)
+	filenames := make(map[string]int)
+	var numbers []int
+	for _, track := range tracks {
+		if track.Number == 0 {
+			continue // Already reported in manifest check
+		}
+
+		if track.Number < 0 || track.Number > manifest.MaxTracks {
+			v.addResult("Tracks", fmt.Sprintf("track %d number", track.Number), false, "error",
+				fmt.Sprintf("track number must be between 1 and %d", manifest.MaxTracks))
+		}
+
+		if seen[track.Number] {
+			v.addResult("Tracks", fmt.Sprintf("track %d number", track.Number), false, "error",
+				"track number is used more than once")
+			continue
+		}
+		seen[track.Number] = true
+		numbers = append(numbers, track.Number)
+
+		if track.Filename != "" {
+			if other, ok := filenames[track.Filename]; ok {
+				v.addResult("Tracks", fmt.Sprintf("track %d filename", track.Number), false, "error",
+					fmt.Sprintf("filename %s is also used by track %d", track.Filename, other))
+			} else {
+				filenames[track.Filename] = track.Number
+			}
+		}
+	}
+
+	sort.Ints(numbers)
+	for i, n := range numbers {
+		if n != i+1 {
+			v.addResult("Tracks", "track numbering", false, "warning",
+				fmt.Sprintf("track numbers are not contiguous: expected %d, found %d", i+1, n))
+			return
+		}
+	}
+	if len(numbers) > 0 {
+		v.addResult("Tracks", "track numbering", true, "", "")
+	}
+}
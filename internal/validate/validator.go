@@ -1,12 +1,18 @@
 package validate
 
 import (
+	"archive/zip"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
+	"github.com/davesmith10/rice-cli/internal/jpeg"
 	"github.com/davesmith10/rice-cli/pkg/manifest"
+	"github.com/davesmith10/rice-cli/pkg/ricecake"
 	"gopkg.in/yaml.v3"
 )
 
@@ -31,6 +37,8 @@ type Report struct {
 type Validator struct {
 	path     string
 	strict   bool
+	fsys     fs.FS
+	archive  *zip.Reader
 	manifest *manifest.Manifest
 	report   *Report
 }
@@ -53,17 +61,29 @@ func (v *Validator) Validate() (*Report, error) {
 	}
 
 	// Handle both directories and .ricecake files
-	if !info.IsDir() {
-		if strings.HasSuffix(v.path, ".ricecake") {
-			return nil, fmt.Errorf("validation of .ricecake files not yet implemented - validate the source directory instead")
-		}
-		return nil, fmt.Errorf("path must be a directory: %s", v.path)
+	if !info.IsDir() && !strings.HasSuffix(v.path, ".ricecake") {
+		return nil, fmt.Errorf("path must be a directory or .ricecake bundle: %s", v.path)
+	}
+
+	b, err := ricecake.Open(v.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open bundle: %w", err)
+	}
+	defer b.Close()
+
+	v.fsys = b.FS()
+	if b.IsArchive() {
+		v.archive = b.Archive()
+		v.validateArchive()
+		v.validateIntegrity(b)
 	}
 
 	// Run validation checks
 	v.validateStructure()
+	v.validateSize()
 	v.validateManifest()
 	v.validateAudio()
+	v.validateTracks()
 	v.validateImages()
 	v.validateSecurity()
 	v.validateCopyright()
@@ -92,32 +112,28 @@ func (v *Validator) addResult(category, check string, passed bool, severity, mes
 
 func (v *Validator) validateStructure() {
 	// Check manifest.yaml exists
-	manifestPath := filepath.Join(v.path, "manifest.yaml")
-	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+	if _, err := fs.Stat(v.fsys, "manifest.yaml"); err != nil {
 		v.addResult("Structure", "manifest.yaml exists", false, "error", "manifest.yaml not found")
 	} else {
 		v.addResult("Structure", "manifest.yaml exists", true, "", "")
 	}
 
 	// Check copyright.txt exists
-	copyrightPath := filepath.Join(v.path, "copyright.txt")
-	if _, err := os.Stat(copyrightPath); os.IsNotExist(err) {
+	if _, err := fs.Stat(v.fsys, "copyright.txt"); err != nil {
 		v.addResult("Structure", "copyright.txt exists", false, "error", "copyright.txt not found")
 	} else {
 		v.addResult("Structure", "copyright.txt exists", true, "", "")
 	}
 
 	// Check audio/ directory exists
-	audioDir := filepath.Join(v.path, "audio")
-	if info, err := os.Stat(audioDir); os.IsNotExist(err) || !info.IsDir() {
+	if info, err := fs.Stat(v.fsys, "audio"); err != nil || !info.IsDir() {
 		v.addResult("Structure", "audio/ directory exists", false, "error", "audio/ directory not found")
 	} else {
 		v.addResult("Structure", "audio/ directory exists", true, "", "")
 	}
 
 	// Check images/ directory exists
-	imagesDir := filepath.Join(v.path, "images")
-	if info, err := os.Stat(imagesDir); os.IsNotExist(err) || !info.IsDir() {
+	if info, err := fs.Stat(v.fsys, "images"); err != nil || !info.IsDir() {
 		v.addResult("Structure", "images/ directory exists", false, "error", "images/ directory not found")
 	} else {
 		v.addResult("Structure", "images/ directory exists", true, "", "")
@@ -126,8 +142,7 @@ func (v *Validator) validateStructure() {
 	// Check cover image exists
 	coverFound := false
 	for _, ext := range []string{".jpg", ".jpeg"} {
-		coverPath := filepath.Join(v.path, "images", "cover"+ext)
-		if _, err := os.Stat(coverPath); err == nil {
+		if _, err := fs.Stat(v.fsys, path.Join("images", "cover"+ext)); err == nil {
 			coverFound = true
 			break
 		}
@@ -140,8 +155,7 @@ func (v *Validator) validateStructure() {
 }
 
 func (v *Validator) validateManifest() {
-	manifestPath := filepath.Join(v.path, "manifest.yaml")
-	data, err := os.ReadFile(manifestPath)
+	data, err := fs.ReadFile(v.fsys, "manifest.yaml")
 	if err != nil {
 		v.addResult("Manifest", "readable", false, "error", fmt.Sprintf("cannot read manifest: %v", err))
 		return
@@ -231,12 +245,10 @@ func (v *Validator) validateManifest() {
 }
 
 func (v *Validator) validateAudio() {
-	audioDir := filepath.Join(v.path, "audio")
-	if _, err := os.Stat(audioDir); os.IsNotExist(err) {
+	entries, err := fs.ReadDir(v.fsys, "audio")
+	if errors.Is(err, fs.ErrNotExist) {
 		return // Already reported in structure check
 	}
-
-	entries, err := os.ReadDir(audioDir)
 	if err != nil {
 		v.addResult("Audio", "readable", false, "error", fmt.Sprintf("cannot read audio directory: %v", err))
 		return
@@ -249,7 +261,7 @@ func (v *Validator) validateAudio() {
 		}
 
 		name := entry.Name()
-		ext := strings.ToLower(filepath.Ext(name))
+		ext := strings.ToLower(path.Ext(name))
 
 		// Check if extension is allowed
 		if !manifest.AllowedAudioExtensions[ext] {
@@ -271,11 +283,19 @@ func (v *Validator) validateAudio() {
 		}
 
 		// Verify magic bytes
-		if err := v.verifyMagicBytes(filepath.Join(audioDir, name), ext); err != nil {
+		if err := v.verifyMagicBytes(path.Join("audio", name), ext); err != nil {
 			v.addResult("Audio", fmt.Sprintf("file %s magic bytes", name), false, "error", err.Error())
 			continue
 		}
 
+		// Inspect the audio stream
+		stream, err := v.probeAudio(path.Join("audio", name), info.Size(), ext)
+		if err != nil {
+			v.addResult("Audio", fmt.Sprintf("file %s stream", name), false, "error", err.Error())
+			continue
+		}
+		v.validateStream(name, stream)
+
 		audioCount++
 		v.addResult("Audio", fmt.Sprintf("file %s", name), true, "", "")
 	}
@@ -286,12 +306,10 @@ func (v *Validator) validateAudio() {
 }
 
 func (v *Validator) validateImages() {
-	imagesDir := filepath.Join(v.path, "images")
-	if _, err := os.Stat(imagesDir); os.IsNotExist(err) {
+	entries, err := fs.ReadDir(v.fsys, "images")
+	if errors.Is(err, fs.ErrNotExist) {
 		return // Already reported in structure check
 	}
-
-	entries, err := os.ReadDir(imagesDir)
 	if err != nil {
 		v.addResult("Images", "readable", false, "error", fmt.Sprintf("cannot read images directory: %v", err))
 		return
@@ -303,7 +321,7 @@ func (v *Validator) validateImages() {
 		}
 
 		name := entry.Name()
-		ext := strings.ToLower(filepath.Ext(name))
+		ext := strings.ToLower(path.Ext(name))
 
 		// Skip README files
 		if ext == ".txt" {
@@ -330,64 +348,66 @@ func (v *Validator) validateImages() {
 		}
 
 		// Verify magic bytes
-		if err := v.verifyMagicBytes(filepath.Join(imagesDir, name), ext); err != nil {
+		if err := v.verifyMagicBytes(path.Join("images", name), ext); err != nil {
 			v.addResult("Images", fmt.Sprintf("file %s magic bytes", name), false, "error", err.Error())
 			continue
 		}
 
+		// Read the JPEG frame header
+		img, err := v.readJPEGInfo(path.Join("images", name))
+		if err != nil {
+			v.addResult("Images", fmt.Sprintf("file %s header", name), false, "error", err.Error())
+			continue
+		}
+
 		// Check cover image dimensions
 		if strings.HasPrefix(strings.ToLower(name), "cover") {
-			if err := v.validateCoverDimensions(filepath.Join(imagesDir, name)); err != nil {
+			if err := validateCoverDimensions(img); err != nil {
 				v.addResult("Images", fmt.Sprintf("file %s dimensions", name), false, "error", err.Error())
 				continue
 			}
 		}
 
+		v.validateImageEncoding(name, img)
+		v.validateDeclaredDimensions(name, img)
+
 		v.addResult("Images", fmt.Sprintf("file %s", name), true, "", "")
 	}
 }
 
 func (v *Validator) validateSecurity() {
-	err := filepath.Walk(v.path, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(v.fsys, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// Skip the root directory
-		if path == v.path {
-			return nil
-		}
-
-		relPath, _ := filepath.Rel(v.path, path)
-
-		// Check for path traversal
-		if strings.Contains(relPath, "..") {
-			v.addResult("Security", fmt.Sprintf("path %s", relPath), false, "error", "path traversal detected")
+		if name == "." {
 			return nil
 		}
 
 		// Check for hidden files (but allow directories)
-		if !info.IsDir() && strings.HasPrefix(filepath.Base(path), ".") {
-			v.addResult("Security", fmt.Sprintf("file %s", relPath), false, "error", "hidden files not allowed")
+		if !d.IsDir() && strings.HasPrefix(d.Name(), ".") {
+			v.addResult("Security", fmt.Sprintf("file %s", name), false, "error", "hidden files not allowed")
 			return nil
 		}
 
 		// Skip directories
-		if info.IsDir() {
+		if d.IsDir() {
 			return nil
 		}
 
 		// Check that all files have extensions
-		ext := filepath.Ext(path)
+		ext := path.Ext(name)
 		if ext == "" {
-			v.addResult("Security", fmt.Sprintf("file %s", relPath), false, "error", "files must have extensions")
+			v.addResult("Security", fmt.Sprintf("file %s", name), false, "error", "files must have extensions")
 			return nil
 		}
 
 		// Check against whitelist
 		ext = strings.ToLower(ext)
 		if !manifest.AllAllowedExtensions[ext] {
-			v.addResult("Security", fmt.Sprintf("file %s", relPath), false, "error", fmt.Sprintf("file type %s not allowed", ext))
+			v.addResult("Security", fmt.Sprintf("file %s", name), false, "error", fmt.Sprintf("file type %s not allowed", ext))
 			return nil
 		}
 
@@ -400,8 +420,7 @@ func (v *Validator) validateSecurity() {
 }
 
 func (v *Validator) validateCopyright() {
-	copyrightPath := filepath.Join(v.path, "copyright.txt")
-	data, err := os.ReadFile(copyrightPath)
+	data, err := fs.ReadFile(v.fsys, "copyright.txt")
 	if err != nil {
 		return // Already reported in structure check
 	}
@@ -436,8 +455,8 @@ func (v *Validator) validateCopyright() {
 	}
 }
 
-func (v *Validator) verifyMagicBytes(path, ext string) error {
-	file, err := os.Open(path)
+func (v *Validator) verifyMagicBytes(name, ext string) error {
+	file, err := v.fsys.Open(name)
 	if err != nil {
 		return fmt.Errorf("cannot open file: %v", err)
 	}
@@ -445,8 +464,8 @@ func (v *Validator) verifyMagicBytes(path, ext string) error {
 
 	// Read first 12 bytes for magic detection
 	header := make([]byte, 12)
-	n, err := file.Read(header)
-	if err != nil || n < 4 {
+	n, err := io.ReadFull(file, header)
+	if (err != nil && err != io.ErrUnexpectedEOF) || n < 4 {
 		return fmt.Errorf("cannot read file header")
 	}
 
@@ -482,27 +501,73 @@ func (v *Validator) verifyMagicBytes(path, ext string) error {
 	return nil
 }
 
-func (v *Validator) validateCoverDimensions(path string) error {
-	file, err := os.Open(path)
+func (v *Validator) readJPEGInfo(name string) (*jpeg.Info, error) {
+	file, err := v.fsys.Open(name)
 	if err != nil {
-		return fmt.Errorf("cannot open file: %v", err)
+		return nil, fmt.Errorf("cannot open file: %v", err)
 	}
 	defer file.Close()
 
-	// We'll use a simple JPEG dimension check
-	// Skip to SOF0 marker to get dimensions
-	// This is a simplified check - for production we'd use image.DecodeConfig
+	return jpeg.ReadInfo(file)
+}
 
-	// For now, just check file exists and has reasonable size
-	info, err := os.Stat(path)
-	if err != nil {
-		return err
+func validateCoverDimensions(img *jpeg.Info) error {
+	if img.Width < manifest.MinCoverDimension || img.Height < manifest.MinCoverDimension {
+		return fmt.Errorf("cover image is %dx%d, minimum is %dx%d",
+			img.Width, img.Height, manifest.MinCoverDimension, manifest.MinCoverDimension)
 	}
 
-	// A 1400x1400 JPEG should be at least ~50KB typically
-	if info.Size() < 10*1024 {
-		return fmt.Errorf("cover image appears too small (file size suggests low resolution)")
+	if img.Width != img.Height {
+		return fmt.Errorf("cover image is %dx%d, must be square", img.Width, img.Height)
 	}
 
 	return nil
 }
+
+// validateImageEncoding warns about JPEG variants that many players render badly
+func (v *Validator) validateImageEncoding(name string, img *jpeg.Info) {
+	switch {
+	case img.CMYK():
+		v.addResult("Images", fmt.Sprintf("file %s color space", name), false, "warning",
+			"CMYK JPEG may render incorrectly in players, use RGB")
+	case img.Grayscale():
+		v.addResult("Images", fmt.Sprintf("file %s color space", name), false, "warning",
+			"grayscale JPEG may render incorrectly in players, use RGB")
+	}
+
+	if img.Progressive {
+		v.addResult("Images", fmt.Sprintf("file %s encoding", name), false, "warning",
+			"progressive JPEG is not supported by all players, use baseline")
+	}
+}
+
+// validateDeclaredDimensions compares the manifest width/height for an image
+// against the real frame size
+func (v *Validator) validateDeclaredDimensions(name string, img *jpeg.Info) {
+	if v.manifest == nil {
+		return
+	}
+
+	for _, declared := range declaredImages(v.manifest) {
+		if declared.Filename != name || (declared.Width == 0 && declared.Height == 0) {
+			continue
+		}
+
+		if declared.Width != img.Width || declared.Height != img.Height {
+			v.addResult("Images", fmt.Sprintf("file %s declared dimensions", name), false, "warning",
+				fmt.Sprintf("manifest declares %dx%d but image is %dx%d",
+					declared.Width, declared.Height, img.Width, img.Height))
+		}
+	}
+}
+
+// declaredImages returns every image listed in the manifest
+func declaredImages(m *manifest.Manifest) []manifest.ImageInfo {
+	images := []manifest.ImageInfo{m.Images.Cover}
+	for _, img := range []*manifest.ImageInfo{m.Images.CoverLarge, m.Images.Back, m.Images.Artist} {
+		if img != nil {
+			images = append(images, *img)
+		}
+	}
+	return images
+}
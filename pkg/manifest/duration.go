@@ -0,0 +1,42 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses a track duration in M:SS or H:MM:SS form
+func ParseDuration(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q: expected M:SS or H:MM:SS", s)
+	}
+
+	total := 0
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i > 0 && (n > 59 || len(part) != 2)) {
+			return 0, fmt.Errorf("invalid duration %q: expected M:SS or H:MM:SS", s)
+		}
+		total = total*60 + n
+	}
+
+	return time.Duration(total) * time.Second, nil
+}
+
+// FormatDuration formats a duration as M:SS, or H:MM:SS from one hour,
+// rounded to the nearest second
+func FormatDuration(d time.Duration) string {
+	totalSeconds := int(d.Round(time.Second) / time.Second)
+
+	hours := totalSeconds / 3600
+	minutes := (totalSeconds % 3600) / 60
+	seconds := totalSeconds % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
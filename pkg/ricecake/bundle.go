@@ -0,0 +1,261 @@
+// Package ricecake reads and writes ricecake bundles.
+package ricecake
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+	"github.com/davesmith10/rice-cli/internal/sign"
+	"github.com/davesmith10/rice-cli/pkg/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// Signature verification failures, distinguishable with errors.Is
+var (
+	ErrUnsigned  = sign.ErrUnsigned
+	ErrMalformed = sign.ErrMalformed
+	ErrTampered  = sign.ErrTampered
+	ErrWrongKey  = sign.ErrWrongKey
+
+	ErrKeyRevoked = sign.ErrKeyRevoked
+	ErrKeyExpired = sign.ErrKeyExpired
+)
+
+// TamperedError lists the files that do not match a bundle's signed
+// checksums.yaml. It matches ErrTampered with errors.Is.
+type TamperedError = sign.TamperedError
+
+// SignatureResult is the outcome of checking one signature in a bundle
+type SignatureResult = sign.Result
+
+// Trust is the set of keys, key validity periods and timestamp
+// authorities that verification accepts
+type Trust = sign.Trust
+
+// KeyPolicy limits when signatures made by a trusted key are accepted
+type KeyPolicy = sign.KeyPolicy
+
+// SignatureStatus describes the outcome of verifying a bundle signature
+type SignatureStatus int
+
+const (
+	StatusUnsigned SignatureStatus = iota
+	StatusValid
+	StatusTampered
+	StatusWrongKey
+	StatusMalformed
+	StatusError
+	StatusRevoked
+	StatusExpired
+)
+
+// String returns a human-readable status
+func (s SignatureStatus) String() string {
+	switch s {
+	case StatusUnsigned:
+		return "unsigned"
+	case StatusValid:
+		return "valid"
+	case StatusTampered:
+		return "tampered"
+	case StatusWrongKey:
+		return "wrong key"
+	case StatusMalformed:
+		return "malformed"
+	case StatusRevoked:
+		return "revoked key"
+	case StatusExpired:
+		return "expired key"
+	default:
+		return "error"
+	}
+}
+
+// Bundle is an opened ricecake bundle, backed either by a .ricecake
+// archive or by a source directory
+type Bundle struct {
+	path    string
+	fsys    fs.FS
+	archive *bundle.Archive
+	size    int64
+}
+
+// Open opens a .ricecake archive or a bundle source directory
+func Open(path string) (*Bundle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("path not found: %s", path)
+	}
+
+	if info.IsDir() {
+		b := &Bundle{path: path, fsys: os.DirFS(path)}
+
+		// Calculate directory size
+		fs.WalkDir(b.fsys, ".", func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if fi, err := d.Info(); err == nil {
+				b.size += fi.Size()
+			}
+			return nil
+		})
+		return b, nil
+	}
+
+	// Archives from third parties are opened with resource limits enforced
+	reader, err := bundle.OpenArchive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bundle{
+		path:    path,
+		fsys:    reader,
+		archive: reader,
+		size:    info.Size(),
+	}, nil
+}
+
+// Close releases the underlying archive, if any
+func (b *Bundle) Close() error {
+	if b.archive != nil {
+		return b.archive.Close()
+	}
+	return nil
+}
+
+// Path returns the path the bundle was opened from
+func (b *Bundle) Path() string {
+	return b.path
+}
+
+// FS returns a read-only view of the bundle contents
+func (b *Bundle) FS() fs.FS {
+	return b.fsys
+}
+
+// IsArchive reports whether the bundle is a .ricecake archive
+func (b *Bundle) IsArchive() bool {
+	return b.archive != nil
+}
+
+// Archive returns the underlying ZIP reader, or nil for directories
+func (b *Bundle) Archive() *zip.Reader {
+	if b.archive == nil {
+		return nil
+	}
+	return b.archive.Reader()
+}
+
+// CheckArchive decompresses every archive entry, checking sizes and
+// CRC-32 checksums. It does nothing for directories.
+func (b *Bundle) CheckArchive() error {
+	if b.archive == nil {
+		return nil
+	}
+	return b.archive.Verify()
+}
+
+// Size returns the archive size, or the total file size of a directory
+func (b *Bundle) Size() int64 {
+	return b.size
+}
+
+// ReadManifest returns the raw manifest.yaml contents
+func (b *Bundle) ReadManifest() ([]byte, error) {
+	data, err := fs.ReadFile(b.fsys, "manifest.yaml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("manifest.yaml not found in bundle")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return data, nil
+}
+
+// Manifest reads and parses manifest.yaml
+func (b *Bundle) Manifest() (*manifest.Manifest, error) {
+	data, err := b.ReadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest.Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Signed reports whether the bundle contains a signature, or an archive
+// has a detached signature file
+func (b *Bundle) Signed() bool {
+	if b.archive != nil {
+		if _, err := os.Stat(b.DetachedSignaturePath()); err == nil {
+			return true
+		}
+	}
+	files, err := sign.SignatureFiles(b.fsys)
+	return err == nil && len(files) > 0
+}
+
+// DetachedSignaturePath returns where an archive's detached signature
+// file is expected: the archive path with .sig appended
+func (b *Bundle) DetachedSignaturePath() string {
+	return sign.DetachedPath(b.path)
+}
+
+// Signatures checks every signature of the bundle, embedded or detached,
+// against the trusted keys
+func (b *Bundle) Signatures(trusted ...ed25519.PublicKey) ([]SignatureResult, error) {
+	return b.SignaturesWith(sign.TrustKeys(trusted...))
+}
+
+// SignaturesWith checks every signature of the bundle against trust,
+// honouring key validity periods, revocations and timestamps
+func (b *Bundle) SignaturesWith(trust *Trust) ([]SignatureResult, error) {
+	if b.archive != nil {
+		return sign.VerifyArchive(b.fsys, b.path, trust)
+	}
+	return sign.VerifyAllFS(b.fsys, trust)
+}
+
+// Verify checks that the bundle carries a valid signature by one of the
+// trusted keys
+func (b *Bundle) Verify(trusted ...ed25519.PublicKey) error {
+	results, err := b.Signatures(trusted...)
+	if err != nil {
+		return err
+	}
+	_, err = sign.Outcome(results, trusted...)
+	return err
+}
+
+// SignatureStatus verifies the bundle signatures and classifies the result
+func (b *Bundle) SignatureStatus(trusted ...ed25519.PublicKey) SignatureStatus {
+	err := b.Verify(trusted...)
+	switch {
+	case err == nil:
+		return StatusValid
+	case errors.Is(err, ErrUnsigned):
+		return StatusUnsigned
+	case errors.Is(err, ErrTampered):
+		return StatusTampered
+	case errors.Is(err, ErrWrongKey):
+		return StatusWrongKey
+	case errors.Is(err, ErrMalformed):
+		return StatusMalformed
+	case errors.Is(err, ErrKeyRevoked):
+		return StatusRevoked
+	case errors.Is(err, ErrKeyExpired):
+		return StatusExpired
+	default:
+		return StatusError
+	}
+}
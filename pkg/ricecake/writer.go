@@ -0,0 +1,16 @@
+package ricecake
+
+import (
+	"io"
+
+	"github.com/davesmith10/rice-cli/internal/bundle"
+)
+
+// Writer builds a .ricecake archive from files or an fs.FS. By default the
+// output is deterministic: identical inputs produce byte-identical archives.
+type Writer = bundle.Writer
+
+// NewWriter creates a writer that writes a bundle to w
+func NewWriter(w io.Writer) *Writer {
+	return bundle.NewWriter(w)
+}